@@ -0,0 +1,348 @@
+// Package config assembles the server configuration from defaults, an optional config
+// file, environment variables and command-line flags, in increasing order of precedence.
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	DrainDelay        time.Duration
+	MaxBodyBytes      int64
+	LogLevel          slog.Level
+
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TrustedProxies is a comma-separated list of IPs and CIDR ranges whose
+	// X-Forwarded-For header is believed.
+	TrustedProxies string
+
+	OrderHistoryFile string
+	CouponStoreFile  string
+	AuditLogFile     string
+	AuditLogMaxBytes int64
+	AuditLogMaxFiles int
+
+	TenantsFile         string
+	APIKeysFile         string
+	RateLimitsFile      string
+	JWTHS256Secret      string
+	JWTRSAPublicKeyFile string
+	JWTJWKSFile         string
+	JWTAudience         string
+	JWTRolesClaim       string
+	JWTTenantClaim      string
+	JWTCustomerClaim    string
+}
+
+// Default is the configuration used for every setting that is not given.
+func Default() Config {
+	return Config{
+		Addr:              ":8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		MaxBodyBytes:      1 << 20,
+		LogLevel:          slog.LevelInfo,
+		AuditLogMaxBytes:  10 << 20,
+		AuditLogMaxFiles:  5,
+	}
+}
+
+// setting is one configuration value: its key in the config file (also the flag name with
+// underscores turned into dashes) and its environment variable.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	set   func(*Config, string) error
+}
+
+var settings = []setting{
+	{"addr", "ADDR", "listen address", stringValue(func(c *Config) *string { return &c.Addr })},
+	{"read_timeout", "READ_TIMEOUT", "maximum time to read a request, including its body", durationValue(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{"read_header_timeout", "READ_HEADER_TIMEOUT", "maximum time to read request headers", durationValue(func(c *Config) *time.Duration { return &c.ReadHeaderTimeout })},
+	{"write_timeout", "WRITE_TIMEOUT", "maximum time to write a response", durationValue(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{"idle_timeout", "IDLE_TIMEOUT", "how long idle keep-alive connections are kept open", durationValue(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "how long in-flight requests may drain on shutdown", durationValue(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{"drain_delay", "DRAIN_DELAY", "how long /readyz fails before shutdown begins, so load balancers stop routing here", durationValue(func(c *Config) *time.Duration { return &c.DrainDelay })},
+	{"max_body_bytes", "MAX_BODY_BYTES", "maximum request body size in bytes", int64Value(func(c *Config) *int64 { return &c.MaxBodyBytes })},
+	{"log_level", "LOG_LEVEL", "minimum level logged: debug, info, warn or error", levelValue(func(c *Config) *slog.Level { return &c.LogLevel })},
+	{"tls_cert_file", "TLS_CERT_FILE", "TLS certificate file; enables HTTPS together with tls_key_file", stringValue(func(c *Config) *string { return &c.TLSCertFile })},
+	{"tls_key_file", "TLS_KEY_FILE", "TLS private key file", stringValue(func(c *Config) *string { return &c.TLSKeyFile })},
+	{"trusted_proxies", "TRUSTED_PROXIES", "comma-separated IPs or CIDR ranges of proxies whose X-Forwarded-For names the client", stringValue(func(c *Config) *string { return &c.TrustedProxies })},
+	{"coupon_store_file", "COUPON_STORE_FILE", "file the coupons, revisions, generated codes and redemptions are saved to", stringValue(func(c *Config) *string { return &c.CouponStoreFile })},
+	{"order_history_file", "ORDER_HISTORY_FILE", "JSON lines file the order history is kept in", stringValue(func(c *Config) *string { return &c.OrderHistoryFile })},
+	{"audit_log_file", "AUDIT_LOG_FILE", "file the audit trail is written to", stringValue(func(c *Config) *string { return &c.AuditLogFile })},
+	{"audit_log_max_bytes", "AUDIT_LOG_MAX_BYTES", "size at which the audit file is rotated", int64Value(func(c *Config) *int64 { return &c.AuditLogMaxBytes })},
+	{"audit_log_max_files", "AUDIT_LOG_MAX_FILES", "number of rotated audit files kept", intValue(func(c *Config) *int { return &c.AuditLogMaxFiles })},
+	{"tenants_file", "TENANTS_FILE", "tenant settings file", stringValue(func(c *Config) *string { return &c.TenantsFile })},
+	{"api_keys_file", "API_KEYS_FILE", "API key file", stringValue(func(c *Config) *string { return &c.APIKeysFile })},
+	{"rate_limits_file", "RATE_LIMITS_FILE", "per-route rate limit and lockout file; replaces the default limits on the apply endpoints", stringValue(func(c *Config) *string { return &c.RateLimitsFile })},
+	{"jwt_hs256_secret", "JWT_HS256_SECRET", "HS256 secret for bearer tokens", stringValue(func(c *Config) *string { return &c.JWTHS256Secret })},
+	{"jwt_rsa_public_key_file", "JWT_RSA_PUBLIC_KEY_FILE", "PEM RSA public key for RS256 bearer tokens", stringValue(func(c *Config) *string { return &c.JWTRSAPublicKeyFile })},
+	{"jwt_jwks_file", "JWT_JWKS_FILE", "JWKS file with bearer token keys", stringValue(func(c *Config) *string { return &c.JWTJWKSFile })},
+	{"jwt_audience", "JWT_AUDIENCE", "audience bearer tokens must be issued for", stringValue(func(c *Config) *string { return &c.JWTAudience })},
+	{"jwt_roles_claim", "JWT_ROLES_CLAIM", "bearer token claim holding the caller's roles", stringValue(func(c *Config) *string { return &c.JWTRolesClaim })},
+	{"jwt_tenant_claim", "JWT_TENANT_CLAIM", "bearer token claim binding the caller to a tenant", stringValue(func(c *Config) *string { return &c.JWTTenantClaim })},
+	{"jwt_customer_claim", "JWT_CUSTOMER_CLAIM", "bearer token claim naming the shopper a token was issued to", stringValue(func(c *Config) *string { return &c.JWTCustomerClaim })},
+}
+
+// Load builds the configuration for a command line (without the program name). The
+// config file is named by the -config flag or CONFIG_FILE; files ending in .json are
+// read as a JSON object and anything else as flat "key: value" lines.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	flags := flag.NewFlagSet("coupon", flag.ContinueOnError)
+	configFile := flags.String("config", getenv("CONFIG_FILE"), "configuration file")
+	flagValues := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flagValues[s.key] = flags.String(strings.ReplaceAll(s.key, "_", "-"), "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	config := Default()
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+		if err != nil {
+			return Config{}, err
+		}
+		if err := apply(&config, values, *configFile); err != nil {
+			return Config{}, err
+		}
+	}
+
+	fromEnv := make(map[string]string)
+	for _, s := range settings {
+		if value := getenv(s.env); value != "" {
+			fromEnv[s.key] = value
+		}
+	}
+	if err := apply(&config, fromEnv, "environment"); err != nil {
+		return Config{}, err
+	}
+
+	fromFlags := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			fromFlags[strings.ReplaceAll(f.Name, "-", "_")] = f.Value.String()
+		}
+	})
+	if err := apply(&config, fromFlags, "flags"); err != nil {
+		return Config{}, err
+	}
+
+	return config, config.validate()
+}
+
+// TLS reports whether the server should serve HTTPS.
+func (c Config) TLS() bool {
+	return c.TLSCertFile != ""
+}
+
+// Proxies parses TrustedProxies. A bare IP is a range of one address.
+func (c Config) Proxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(c.TrustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %q is not an IP or CIDR range", entry)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (c Config) validate() error {
+	if _, err := c.Proxies(); err != nil {
+		return err
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	if c.MaxBodyBytes <= 0 {
+		return fmt.Errorf("max_body_bytes must be positive")
+	}
+	for name, timeout := range map[string]time.Duration{
+		"read_timeout":        c.ReadTimeout,
+		"read_header_timeout": c.ReadHeaderTimeout,
+		"write_timeout":       c.WriteTimeout,
+		"idle_timeout":        c.IdleTimeout,
+		"shutdown_timeout":    c.ShutdownTimeout,
+		"drain_delay":         c.DrainDelay,
+	} {
+		if timeout < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	return nil
+}
+
+func apply(config *Config, values map[string]string, source string) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s, ok := findSetting(key)
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", source, key)
+		}
+		if err := s.set(config, values[key]); err != nil {
+			return fmt.Errorf("%s: %s: %v", source, key, err)
+		}
+	}
+	return nil
+}
+
+func findSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func readFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return parseJSON(content)
+	}
+	return parseKeyValues(content)
+}
+
+func parseJSON(content []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var document map[string]interface{}
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid config file: %v", err)
+	}
+
+	values := make(map[string]string, len(document))
+	for key, value := range document {
+		switch value := value.(type) {
+		case string:
+			values[key] = value
+		case json.Number:
+			values[key] = value.String()
+		default:
+			return nil, fmt.Errorf("invalid config file: %s must be a string or a number", key)
+		}
+	}
+	return values, nil
+}
+
+// parseKeyValues reads the flat subset of YAML the config file needs: one "key: value"
+// per line, blank lines and # comments ignored, values optionally quoted.
+func parseKeyValues(content []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(text, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid config file: line %d: expected key: value", line)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		} else if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+func stringValue(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func durationValue(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration such as 15s")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func int64Value(field func(*Config) *int64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func intValue(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("must be a non-negative integer")
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func levelValue(field func(*Config) *slog.Level) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("must be debug, info, warn or error")
+		}
+		*field(c) = level
+		return nil
+	}
+}
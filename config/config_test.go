@@ -0,0 +1,119 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	config, err := Load(nil, env(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config != Default() {
+		t.Fatalf("Expected defaults, got %+v", config)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "coupon.yaml")
+	content := `# server settings
+addr: ":9000"
+read_timeout: 5s
+write_timeout: "20s"
+max_body_bytes: 2048 # bytes
+order_history_file: '/var/lib/coupon/orders.jsonl'
+`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load([]string{"-write-timeout", "45s"}, env(map[string]string{
+		"CONFIG_FILE":  file,
+		"READ_TIMEOUT": "7s",
+		"LOG_LEVEL":    "debug",
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if config.Addr != ":9000" || config.MaxBodyBytes != 2048 || config.OrderHistoryFile != "/var/lib/coupon/orders.jsonl" {
+		t.Fatalf("Expected file values, got %+v", config)
+	}
+	if config.ReadTimeout != 7*time.Second {
+		t.Fatalf("Expected environment to override file, got %s", config.ReadTimeout)
+	}
+	if config.WriteTimeout != 45*time.Second {
+		t.Fatalf("Expected flag to override file, got %s", config.WriteTimeout)
+	}
+	if config.LogLevel != slog.LevelDebug {
+		t.Fatalf("Expected debug log level, got %s", config.LogLevel)
+	}
+	if config.IdleTimeout != Default().IdleTimeout {
+		t.Fatalf("Expected default idle timeout, got %s", config.IdleTimeout)
+	}
+}
+
+func TestLoad_JSONFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "coupon.json")
+	content := `{"addr": ":8443", "tls_cert_file": "cert.pem", "tls_key_file": "key.pem", "audit_log_max_files": 3}`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load([]string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !config.TLS() || config.AuditLogMaxFiles != 3 || config.Addr != ":8443" {
+		t.Fatalf("Expected JSON values, got %+v", config)
+	}
+}
+
+func TestConfig_Proxies(t *testing.T) {
+	config, err := Load([]string{"-trusted-proxies", "10.0.0.0/8, 192.0.2.7"}, env(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	proxies, _ := config.Proxies()
+	if len(proxies) != 2 || proxies[0].String() != "10.0.0.0/8" || proxies[1].String() != "192.0.2.7/32" {
+		t.Fatalf("Expected a range and a single address, got %v", proxies)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		args []string
+		env  map[string]string
+	}{
+		"bad duration":     {env: map[string]string{"IDLE_TIMEOUT": "forever"}},
+		"negative size":    {args: []string{"-max-body-bytes", "-1"}},
+		"zero size":        {env: map[string]string{"MAX_BODY_BYTES": "0"}},
+		"cert without key": {env: map[string]string{"TLS_CERT_FILE": "cert.pem"}},
+		"unknown flag":     {args: []string{"-listen", ":80"}},
+		"bad log level":    {env: map[string]string{"LOG_LEVEL": "loud"}},
+		"negative drain":   {args: []string{"-drain-delay", "-5s"}},
+		"bad proxy":        {env: map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, lb.internal"}},
+		"missing file":     {args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}},
+	}
+	for name, test := range tests {
+		if _, err := Load(test.args, env(test.env)); err == nil {
+			t.Errorf("%s: expected configuration to be rejected", name)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "coupon.yaml")
+	if err := os.WriteFile(file, []byte("listen_addr: :80\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load([]string{"-config", file}, env(nil)); err == nil {
+		t.Errorf("Expected unknown setting to be rejected")
+	}
+}
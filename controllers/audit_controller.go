@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+)
+
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	entries, err := services.QueryAudit(query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	if err := services.VerifyAudit(); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]bool{
+		"valid": true,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,42 @@
+package controllers_test
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestAuditLog_RecordsAuthenticatedActor(t *testing.T) {
+	setup(t)
+	audit := services.Audit
+	services.Audit = services.NewAuditLog()
+	defer func() { services.Audit = audit }()
+	useAPIKeys(t, models.APIKey{ID: "admin", Hash: services.HashAPIKey("admin-key"), Scopes: []string{services.ScopeCouponsWrite, services.ScopeAuditRead}})
+
+	header := http.Header{"X-Api-Key": {"admin-key"}, "X-Actor": {"someone-else"}}
+	if recorder := serve(t, "POST", "/coupons", testCoupon, header); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected coupon to be created, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder := serve(t, "GET", "/audit?actor=admin", "", http.Header{"X-Api-Key": {"admin-key"}})
+	var response struct {
+		Entries []models.AuditEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || recorder.Code != http.StatusOK {
+		t.Fatalf("Expected audit entries, got %d, %v", recorder.Code, err)
+	}
+	if len(response.Entries) != 1 {
+		t.Fatalf("Expected one entry for the authenticated caller, got %+v", response.Entries)
+	}
+	actor := response.Entries[0].Actor
+	if actor.ID != "admin" || actor.ClaimedID != "someone-else" || actor.IP != "192.0.2.1" || actor.RequestID == "" {
+		t.Fatalf("Expected the key as actor and X-Actor only as a claim, got %+v", actor)
+	}
+
+	recorder = serve(t, "GET", "/audit?actor=someone-else", "", http.Header{"X-Api-Key": {"admin-key"}})
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || len(response.Entries) != 0 {
+		t.Fatalf("Expected the claimed name not to match the actor filter, got %+v, %v", response.Entries, err)
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"context"
+	"coupon/models"
+	"coupon/services"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	tenantHeader = "X-Tenant-ID"
+)
+
+type (
+	principalContextKey      struct{}
+	tenantContextKey         struct{}
+	authenticationContextKey struct{}
+)
+
+// authentication is the outcome of checking a request's credentials.
+type authentication struct {
+	principal models.Principal
+	err       error
+}
+
+// RequireScope wraps a handler so it only runs for callers granted scope, either by their
+// API key or by the roles in their bearer token, and resolves the tenant the request acts
+// on. Failed attempts are logged without the presented credentials. When neither API keys
+// nor token keys are configured every caller is let through.
+func RequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var principal models.Principal
+		if services.APIKeys != nil || services.BearerTokens != nil {
+			var err error
+			r, principal, err = authenticateOnce(r)
+			if err == nil {
+				err = services.Authorize(principal, scope)
+			}
+			if err != nil {
+				logRejection(r, principal, err)
+				if errors.Is(err, services.ErrUnauthorized) {
+					w.Header().Set("WWW-Authenticate", challenge(err))
+				}
+				handleError(w, err)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal))
+		}
+
+		tenant, err := requestTenant(r, principal)
+		if err != nil {
+			logRejection(r, principal, err)
+			handleError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+	}
+}
+
+// logRejection records a failed authentication, authorization or tenant check without the
+// presented credentials.
+func logRejection(r *http.Request, principal models.Principal, err error) {
+	requestLogger(r).Warn("request rejected",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"client_ip", clientIP(r),
+		"caller", principal.ID,
+		"code", errorCode(err),
+		"error", err.Error(),
+	)
+}
+
+// requestTenant takes the tenant from X-Tenant-ID. Credentials bound to a tenant always
+// act on that tenant, and a header naming another one is rejected; unbound credentials may
+// act on any tenant.
+func requestTenant(r *http.Request, principal models.Principal) (string, error) {
+	tenant := strings.TrimSpace(r.Header.Get(tenantHeader))
+	if principal.Tenant != "" {
+		if tenant != "" && tenant != principal.Tenant {
+			return "", services.ErrTenantMismatch
+		}
+		tenant = principal.Tenant
+	}
+	if _, err := services.ResolveTenant(tenant); err != nil {
+		return "", err
+	}
+	return tenant, nil
+}
+
+// tenantOf is the tenant resolved by RequireScope; requests that did not pass through it
+// act on the default tenant.
+func tenantOf(r *http.Request) string {
+	tenant, _ := r.Context().Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// authenticateOnce authenticates r and keeps the outcome on the returned request, so
+// RateLimit and RequireScope check the credentials only once. Without API keys or token
+// keys every request is anonymous.
+func authenticateOnce(r *http.Request) (*http.Request, models.Principal, error) {
+	if services.APIKeys == nil && services.BearerTokens == nil {
+		return r, models.Principal{}, nil
+	}
+	if cached, ok := r.Context().Value(authenticationContextKey{}).(authentication); ok {
+		return r, cached.principal, cached.err
+	}
+	principal, err := authenticate(r)
+	r = r.WithContext(context.WithValue(r.Context(), authenticationContextKey{}, authentication{principal, err}))
+	return r, principal, err
+}
+
+// authenticate uses the bearer token when one is sent and tokens are accepted, and the
+// API key otherwise.
+func authenticate(r *http.Request) (models.Principal, error) {
+	if token, ok := bearerToken(r); ok && services.BearerTokens != nil {
+		return services.BearerTokens.Verify(token, time.Now())
+	}
+	if services.APIKeys != nil {
+		return services.APIKeys.Authenticate(r.Header.Get(apiKeyHeader))
+	}
+	return models.Principal{}, services.ErrCredentialsRequired
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func challenge(err error) string {
+	if errors.Is(err, services.ErrInvalidToken) {
+		return `Bearer error="invalid_token"`
+	}
+	if services.BearerTokens != nil {
+		return "Bearer"
+	}
+	return `APIKey header="` + apiKeyHeader + `"`
+}
+
+func principalFrom(r *http.Request) (models.Principal, bool) {
+	principal, ok := r.Context().Value(principalContextKey{}).(models.Principal)
+	return principal, ok
+}
@@ -0,0 +1,173 @@
+package controllers_test
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testCoupon = `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`
+
+// useTenants configures the tenants acme and globex for the rest of the test.
+func useTenants(t *testing.T) {
+	t.Helper()
+	tenants := services.Tenants
+	services.Tenants = map[string]models.Tenant{
+		"acme":   {ID: "acme", Currency: "EUR", Timezone: services.DefaultTimezone},
+		"globex": {ID: "globex", Currency: "USD", Timezone: services.DefaultTimezone},
+	}
+	t.Cleanup(func() { services.Tenants = tenants })
+}
+
+func useAPIKeys(t *testing.T, keys ...models.APIKey) {
+	t.Helper()
+	store, err := services.NewAPIKeyStore(keys)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	services.APIKeys = store
+}
+
+// hs256Token signs claims with secret.
+func hs256Token(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		content, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	signed := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	setup(t)
+	useAPIKeys(t,
+		models.APIKey{ID: "admin", Hash: services.HashAPIKey("admin-key"), Scopes: []string{services.ScopeCouponsRead, services.ScopeCouponsWrite}},
+		models.APIKey{ID: "storefront", Hash: services.HashAPIKey("storefront-key"), Scopes: []string{services.ScopeCouponsRead, services.ScopeCartsApply}},
+	)
+
+	recorder := serve(t, "POST", "/coupons", testCoupon, nil)
+	expectProblem(t, recorder, http.StatusUnauthorized, "credentials_required")
+	if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != `APIKey header="X-API-Key"` {
+		t.Fatalf("Expected an API key challenge, got %q", challenge)
+	}
+
+	recorder = serve(t, "POST", "/coupons", testCoupon, http.Header{"X-Api-Key": {"guess"}})
+	expectProblem(t, recorder, http.StatusUnauthorized, "invalid_credentials")
+	if recorder.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("Expected a challenge with 401")
+	}
+
+	recorder = serve(t, "POST", "/coupons", testCoupon, http.Header{"X-Api-Key": {"storefront-key"}})
+	body := expectProblem(t, recorder, http.StatusForbidden, "insufficient_scope")
+	if body.Details["required_scope"] != services.ScopeCouponsWrite {
+		t.Fatalf("Expected the required scope in details, got %+v", body)
+	}
+	if recorder.Header().Get("WWW-Authenticate") != "" {
+		t.Fatalf("Expected no challenge with 403, got %q", recorder.Header().Get("WWW-Authenticate"))
+	}
+
+	if recorder := serve(t, "POST", "/coupons", testCoupon, http.Header{"X-Api-Key": {"admin-key"}}); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected admin key to create a coupon, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(t, "GET", "/coupons/1", "", http.Header{"X-Api-Key": {"storefront-key"}}); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected storefront key to read coupons, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Probes are not authenticated.
+	if recorder := serve(t, "GET", "/healthz", "", nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected /healthz without credentials, got %d", recorder.Code)
+	}
+}
+
+func TestAPIKeyAuthentication_TenantBinding(t *testing.T) {
+	setup(t)
+	useTenants(t)
+	useAPIKeys(t, models.APIKey{ID: "acme-admin", Tenant: "acme", Hash: services.HashAPIKey("acme-key"), Scopes: []string{services.ScopeCouponsRead, services.ScopeCouponsWrite}})
+
+	header := http.Header{"X-Api-Key": {"acme-key"}, "X-Tenant-Id": {"globex"}}
+	expectProblem(t, serve(t, "GET", "/coupons", "", header), http.StatusForbidden, "tenant_mismatch")
+
+	header = http.Header{"X-Api-Key": {"acme-key"}}
+	if recorder := serve(t, "POST", "/coupons", testCoupon, header); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected coupon to be created for acme, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := services.GetTenantCoupon("acme", "1"); err != nil {
+		t.Fatalf("Expected the coupon to belong to acme, got %v", err)
+	}
+}
+
+func TestBearerTokenAuthentication(t *testing.T) {
+	setup(t)
+	verifier := services.NewJWTVerifier("coupon-api")
+	verifier.AddHMACKey("", []byte("shared-secret"))
+	services.BearerTokens = verifier
+
+	claims := func(role string) map[string]interface{} {
+		return map[string]interface{}{"sub": "user-1", "aud": "coupon-api", "roles": []string{role}, "exp": time.Now().Add(time.Hour).Unix()}
+	}
+
+	recorder := serve(t, "GET", "/coupons", "", nil)
+	expectProblem(t, recorder, http.StatusUnauthorized, "credentials_required")
+	if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != "Bearer" {
+		t.Fatalf("Expected a bearer challenge, got %q", challenge)
+	}
+
+	recorder = serve(t, "GET", "/coupons", "", bearer(hs256Token(t, "wrong-secret", claims(services.RoleAdmin))))
+	expectProblem(t, recorder, http.StatusUnauthorized, "invalid_token")
+	if challenge := recorder.Header().Get("WWW-Authenticate"); challenge != `Bearer error="invalid_token"` {
+		t.Fatalf("Expected an invalid_token challenge, got %q", challenge)
+	}
+
+	expired := claims(services.RoleAdmin)
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	expectProblem(t, serve(t, "GET", "/coupons", "", bearer(hs256Token(t, "shared-secret", expired))), http.StatusUnauthorized, "invalid_token")
+
+	storefront := bearer(hs256Token(t, "shared-secret", claims(services.RoleStorefront)))
+	expectProblem(t, serve(t, "POST", "/coupons", testCoupon, storefront), http.StatusForbidden, "insufficient_scope")
+
+	marketer := bearer(hs256Token(t, "shared-secret", claims(services.RoleMarketer)))
+	if recorder := serve(t, "POST", "/coupons", testCoupon, marketer); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected marketer to create a coupon, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	expectProblem(t, serve(t, "GET", "/audit", "", marketer), http.StatusForbidden, "insufficient_scope")
+}
+
+func TestBearerTokenAuthentication_BindsCartCustomer(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5, "max_uses_per_customer": 1}}`)
+	verifier := services.NewJWTVerifier("")
+	verifier.AddHMACKey("", []byte("shared-secret"))
+	services.BearerTokens = verifier
+
+	header := bearer(hs256Token(t, "shared-secret", map[string]interface{}{
+		"sub": "storefront", "roles": []string{services.RoleStorefront}, "customer_id": "c1", "exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	cart := func(customer string) string {
+		return `{"cart": {"customer_id": "` + customer + `", "items": [{"product_id": "A123", "quantity": 1, "price": 150}]}}`
+	}
+
+	if recorder := serve(t, "POST", "/apply-coupon/1", cart(""), header); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the token's customer to redeem, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	expectProblem(t, serve(t, "POST", "/apply-coupon/1", cart("c1"), header), http.StatusUnprocessableEntity, "customer_usage_limit_exceeded")
+	expectProblem(t, serve(t, "POST", "/apply-coupon/1", cart("c2"), header), http.StatusForbidden, "customer_mismatch")
+
+	body := `{"cart": {"customer": {"id": "c2"}, "items": [{"product_id": "A123", "quantity": 1, "price": 150}]}}`
+	expectProblem(t, serve(t, "POST", "/apply-coupon/1", body, header), http.StatusForbidden, "customer_mismatch")
+}
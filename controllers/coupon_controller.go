@@ -3,9 +3,10 @@ package controllers
 import (
 	"coupon/models"
 	"coupon/services"
+	"encoding/csv"
 	"encoding/json"
-	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -15,53 +16,94 @@ const (
 	internalServerError       = "Internal server error"
 	couponUpdatedSuccessfully = "Coupon updated successfully"
 	couponDeletedSuccessfully = "Coupon deleted successfully"
+	orderRecordedSuccessfully = "Order recorded successfully"
+	codeFlushInterval         = 1000
 )
 
 func ApplyCoupon(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	couponID := params["id"]
 
-	var cartRequest struct {
-		Cart models.Cart `json:"cart"`
+	var request cartRequest
+	if err := decodeCart(w, r, &request, &request); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	appliedCoupons := make(map[string]bool)
+
+	updatedCart, err := services.ApplyCouponAs(request.Cart, couponID, appliedCoupons, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"updated_cart": updatedCart,
+	}
+	if request.normalization != nil {
+		response["normalization"] = request.normalization
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&cartRequest); err != nil {
-		handleError(w, invalidRequestBody, http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func ApplyCouponByCode(w http.ResponseWriter, r *http.Request) {
+	var codeRequest struct {
+		cartRequest
+		Code string `json:"code"`
+	}
+	if err := decodeCart(w, r, &codeRequest, &codeRequest.cartRequest); err != nil {
+		handleError(w, err)
 		return
 	}
 
 	appliedCoupons := make(map[string]bool)
 
-	updatedCart, err := services.ApplyCoupon(cartRequest.Cart, couponID, appliedCoupons)
+	updatedCart, err := services.ApplyCouponByCodeAs(codeRequest.Cart, codeRequest.Code, appliedCoupons, actorFrom(r))
 	if err != nil {
-		handleError(w, err.Error(), http.StatusBadRequest)
+		handleError(w, err)
 		return
 	}
 
 	response := map[string]interface{}{
 		"updated_cart": updatedCart,
 	}
+	if codeRequest.normalization != nil {
+		response["normalization"] = codeRequest.normalization
+	}
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
 func CreateCoupon(w http.ResponseWriter, r *http.Request) {
 	var coupon models.Coupon
-	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
-		handleError(w, invalidRequestBody, http.StatusBadRequest)
+	if err := decodeStrict(r, &coupon); err != nil {
+		handleError(w, invalidBody(err))
 		return
 	}
 
-	if err := services.CreateCoupon(coupon); err != nil {
-		handleError(w, err.Error(), http.StatusBadRequest)
+	coupon.TenantID = tenantOf(r)
+	if err := services.CreateCouponAs(coupon, actorFrom(r)); err != nil {
+		handleError(w, err)
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(coupon); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+	created, err := services.GetTenantCoupon(coupon.TenantID, coupon.ID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(created.Version))
+	if err := json.NewEncoder(w).Encode(created); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
@@ -70,95 +112,298 @@ func UpdateCoupon(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	couponID := params["id"]
 
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
 	var updatedCoupon models.Coupon
-	if err := json.NewDecoder(r.Body).Decode(&updatedCoupon); err != nil {
-		handleError(w, invalidRequestBody, http.StatusBadRequest)
+	if err := decodeStrict(r, &updatedCoupon); err != nil {
+		handleError(w, invalidBody(err))
 		return
 	}
 
-	if err := services.UpdateCoupon(couponID, updatedCoupon); err != nil {
-		handleError(w, err.Error(), http.StatusNotFound)
+	replaced, err := services.ReplaceCoupon(tenantOf(r), couponID, updatedCoupon, expectedVersion, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(replaced.Version))
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": couponUpdatedSuccessfully,
 	}); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func PatchCoupon(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	patch, err := readMergePatch(w, r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	coupon, err := services.PatchCoupon(tenantOf(r), params["id"], patch, expectedVersion, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(coupon.Version))
+	if err := json.NewEncoder(w).Encode(coupon); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func TransitionCoupon(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	expectedVersion, err := optionalIfMatchVersion(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	coupon, err := services.TransitionCoupon(tenantOf(r), params["id"], params["action"], expectedVersion, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(coupon.Version))
+	if err := json.NewEncoder(w).Encode(coupon); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func GetCouponRevisions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	revisions, err := services.GetCouponRevisions(tenantOf(r), params["id"])
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"revisions": revisions,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func RollbackCoupon(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	expectedVersion, err := optionalIfMatchVersion(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	var rollbackRequest struct {
+		Revision int `json:"revision"`
+	}
+	if err := decodeStrict(r, &rollbackRequest); err != nil {
+		handleError(w, invalidBody(err))
+		return
+	}
+
+	coupon, err := services.RollbackCoupon(tenantOf(r), params["id"], rollbackRequest.Revision, expectedVersion, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", etag(coupon.Version))
+	if err := json.NewEncoder(w).Encode(coupon); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
 func GetAllCoupons(w http.ResponseWriter, r *http.Request) {
-	coupons := services.GetAllCoupons()
-	if err := json.NewEncoder(w).Encode(coupons); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+	query, err := parseCouponQuery(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	page, err := services.ListCoupons(query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", page.NextCursor)
+		next.RawQuery = values.Encode()
+		w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+
+	if err := json.NewEncoder(w).Encode(page.Coupons); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
 func GetCouponByID(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	coupon, err := services.GetCouponByID(params["id"])
+	coupon, err := services.GetTenantCoupon(tenantOf(r), params["id"])
 	if err != nil {
-		handleError(w, err.Error(), http.StatusNotFound)
+		handleError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", etag(coupon.Version))
 	if err := json.NewEncoder(w).Encode(coupon); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
 func DeleteCoupon(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	if err := services.DeleteCoupon(params["id"]); err != nil {
-		handleError(w, err.Error(), http.StatusNotFound)
+
+	expectedVersion, err := ifMatchVersion(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := services.DeleteCouponVersion(tenantOf(r), params["id"], expectedVersion, actorFrom(r)); err != nil {
+		handleError(w, err)
 		return
 	}
 
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"message": couponDeletedSuccessfully,
 	}); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
 func GetApplicableCoupons(w http.ResponseWriter, r *http.Request) {
-	var cartRequest struct {
-		Cart models.Cart `json:"cart"`
+	var request cartRequest
+	if err := decodeCart(w, r, &request, &request); err != nil {
+		handleError(w, err)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&cartRequest); err != nil {
-		handleError(w, invalidRequestBody, http.StatusBadRequest)
+	applicableCoupons, nonApplicableCoupons, err := services.EvaluateCoupons(request.Cart)
+	if err != nil {
+		handleError(w, err)
 		return
 	}
 
-	applicableCoupons := []map[string]interface{}{}
-	appliedCoupons := make(map[string]bool)
+	response := map[string]interface{}{
+		"applicable_coupons":     applicableCoupons,
+		"non_applicable_coupons": nonApplicableCoupons,
+	}
+	if request.normalization != nil {
+		response["normalization"] = request.normalization
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func GenerateCodes(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	var batchRequest models.CodeBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batchRequest); err != nil {
+		handleError(w, invalidBody(err))
+		return
+	}
+
+	csvWriter := csv.NewWriter(w)
+	written := 0
+
+	err := services.GenerateCodes(tenantOf(r), params["id"], batchRequest, func(code models.GeneratedCode) error {
+		if written == 0 {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="codes.csv"`)
+			if err := csvWriter.Write([]string{"code", "coupon_id", "max_uses"}); err != nil {
+				return err
+			}
+		}
+		written++
 
-	for _, coupon := range services.GetAllCoupons() {
-		updatedCart, err := services.ApplyCoupon(cartRequest.Cart, coupon.ID, appliedCoupons)
-		if err == nil && updatedCart.TotalDiscount > 0 {
-			applicableCoupons = append(applicableCoupons, map[string]interface{}{
-				"coupon_id": coupon.ID,
-				"type":      coupon.Type,
-				"discount":  updatedCart.TotalDiscount,
-			})
+		if err := csvWriter.Write([]string{code.Code, code.CouponID, strconv.Itoa(code.MaxUses)}); err != nil {
+			return err
+		}
+		if written%codeFlushInterval == 0 {
+			csvWriter.Flush()
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+			return csvWriter.Error()
 		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			handleError(w, err)
+			return
+		}
+		requestLogger(r).Error("failed to stream generated codes", "error", err)
+		return
 	}
 
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		requestLogger(r).Error("failed to stream generated codes", "error", err)
+	}
+}
+
+func GetCustomerRedemptions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	redemptions := services.GetCustomerRedemptions(tenantOf(r), params["id"])
 	if err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"applicable_coupons": applicableCoupons,
+		"redemptions": redemptions,
 	}); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+		requestLogger(r).Error("failed to encode response", "error", err)
 		http.Error(w, internalServerError, http.StatusInternalServerError)
 	}
 }
 
-func handleError(w http.ResponseWriter, message string, statusCode int) {
-	log.Printf("Error: %s", message)
-	http.Error(w, message, statusCode)
+func RecordOrder(w http.ResponseWriter, r *http.Request) {
+	var order models.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		handleError(w, invalidBody(err))
+		return
+	}
+
+	order.TenantID = tenantOf(r)
+	if err := services.RecordOrder(order); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"message": orderRecordedSuccessfully,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+	}
 }
@@ -0,0 +1,57 @@
+package controllers_test
+
+import (
+	"encoding/csv"
+	"net/http"
+	"testing"
+)
+
+func TestGenerateCodes_StreamsCSV(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5000}}`)
+
+	recorder := serve(t, "POST", "/coupons/1/codes", `{"count": 2500, "prefix": "SPRING-", "max_uses": 2}`, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Content-Type") != "text/csv" || recorder.Header().Get("Content-Disposition") != `attachment; filename="codes.csv"` {
+		t.Fatalf("Expected a CSV attachment, got %v", recorder.Header())
+	}
+	if !recorder.Flushed {
+		t.Fatalf("Expected a batch this large to be flushed while streaming")
+	}
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(records) != 2501 || records[0][0] != "code" || records[0][1] != "coupon_id" || records[0][2] != "max_uses" {
+		t.Fatalf("Expected a header and 2500 codes, got %d records starting %v", len(records), records[0])
+	}
+	seen := make(map[string]bool)
+	for _, record := range records[1:] {
+		if seen[record[0]] || record[1] != "1" || record[2] != "2" {
+			t.Fatalf("Expected unique codes for coupon 1 with max_uses 2, got %v", record)
+		}
+		seen[record[0]] = true
+	}
+
+	cart := `{"code": "` + records[1][0] + `", "cart": {"items": [{"product_id": "A123", "quantity": 1, "price": 150}]}}`
+	if recorder := serve(t, "POST", "/apply-code", cart, nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected a generated code to apply, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	cart = `{"cart": {"items": [{"product_id": "A123", "quantity": 1, "price": 150}]}}`
+	expectProblem(t, serve(t, "POST", "/apply-coupon/1", cart, nil), http.StatusUnprocessableEntity, "generated_code_required")
+}
+
+func TestGenerateCodes_ErrorsBeforeStreaming(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`)
+
+	body := expectProblem(t, serve(t, "POST", "/coupons/1/codes", `{"count": 10, "alphabet": "ÄÖÜ"}`, nil), http.StatusBadRequest, "invalid_alphabet")
+	if body.Field != "alphabet" {
+		t.Fatalf("Expected the alphabet field to be named, got %+v", body)
+	}
+	expectProblem(t, serve(t, "POST", "/coupons/missing/codes", `{"count": 10}`, nil), http.StatusNotFound, "coupon_not_found")
+}
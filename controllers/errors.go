@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"coupon/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details body extended with the service error's stable
+// code, message, field and details.
+type problem struct {
+	Type    string                 `json:"type"`
+	Title   string                 `json:"title"`
+	Status  int                    `json:"status"`
+	Detail  string                 `json:"detail"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Field   string                 `json:"field,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// invalidBody describes a request body that could not be decoded, including one cut off
+// by the body size limit.
+func invalidBody(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &services.Error{
+			Kind:    services.ErrTooLarge,
+			Code:    "request_too_large",
+			Message: fmt.Sprintf("request body cannot exceed %d bytes", tooLarge.Limit),
+		}
+	}
+	return &services.Error{
+		Kind:    services.ErrInvalid,
+		Code:    "invalid_request_body",
+		Message: invalidRequestBody,
+		Details: map[string]interface{}{"cause": err.Error()},
+	}
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrNotApplicable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUnsupported):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrPrecondition):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, services.ErrPreconditionRequired):
+		return http.StatusPreconditionRequired
+	case errors.Is(err, services.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// handleError writes err as a problem details response. The error is logged with the
+// request's access log line when the writer is instrumented, and on its own otherwise.
+func handleError(w http.ResponseWriter, err error) {
+	if recorder, ok := w.(*statusRecorder); ok {
+		recorder.err = err
+	} else {
+		slog.Warn("request failed", "code", errorCode(err), "error", err)
+	}
+
+	status := statusFor(err)
+	body := problem{
+		Type:    "about:blank",
+		Title:   http.StatusText(status),
+		Status:  status,
+		Detail:  internalServerError,
+		Code:    "internal_error",
+		Message: internalServerError,
+	}
+
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		body.Type = "urn:coupon:error:" + serviceErr.Code
+		body.Detail = serviceErr.Message
+		body.Code = serviceErr.Code
+		body.Message = serviceErr.Message
+		body.Field = serviceErr.Field
+		body.Details = serviceErr.Details
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
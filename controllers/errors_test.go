@@ -0,0 +1,141 @@
+package controllers_test
+
+import (
+	"coupon/controllers"
+	"coupon/models"
+	"coupon/router"
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// problem mirrors the problem details body written for failed requests.
+type problem struct {
+	Type    string                 `json:"type"`
+	Title   string                 `json:"title"`
+	Status  int                    `json:"status"`
+	Detail  string                 `json:"detail"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Field   string                 `json:"field"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// setup marks the server ready, empties the coupon stores and turns off authentication
+// and rate limiting; tests that need them configure their own and are restored afterwards.
+func setup(t *testing.T) {
+	t.Helper()
+	controllers.SetReadiness(controllers.Ready)
+	services.Coupons = make(map[string]models.Coupon)
+	services.CouponCodes = make(map[string]string)
+	services.CouponRevisions = make(map[string][]models.CouponRevision)
+	services.GeneratedCodes = make(map[string]models.GeneratedCode)
+	services.Redemptions = make(map[string][]models.Redemption)
+
+	apiKeys, bearerTokens, rateLimits := services.APIKeys, services.BearerTokens, services.RateLimits
+	services.APIKeys, services.BearerTokens, services.RateLimits = nil, nil, nil
+	t.Cleanup(func() {
+		services.APIKeys, services.BearerTokens, services.RateLimits = apiKeys, bearerTokens, rateLimits
+	})
+}
+
+// serve sends a request through the full router, so middleware and route templates run
+// as they do in the server.
+func serve(t *testing.T, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveFrom(t, "192.0.2.1:1234", method, target, body, header)
+}
+
+// serveFrom is serve for a request from the client at remoteAddr.
+func serveFrom(t *testing.T, remoteAddr, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.RemoteAddr = remoteAddr
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	router.Router().ServeHTTP(recorder, request)
+	return recorder
+}
+
+// expectProblem checks a problem details response and returns its body.
+func expectProblem(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) problem {
+	t.Helper()
+	if recorder.Code != status {
+		t.Fatalf("Expected status %d, got %d: %s", status, recorder.Code, recorder.Body.String())
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/problem+json" {
+		t.Fatalf("Expected application/problem+json, got %q", contentType)
+	}
+
+	var body problem
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected a problem body, got %v", err)
+	}
+	if body.Status != status || body.Code != code || body.Type != "urn:coupon:error:"+code || body.Title != http.StatusText(status) {
+		t.Fatalf("Expected %d %s problem, got %+v", status, code, body)
+	}
+	if body.Detail == "" || body.Detail != body.Message {
+		t.Fatalf("Expected detail to repeat the message, got %+v", body)
+	}
+	return body
+}
+
+func createCoupon(t *testing.T, coupon string) {
+	t.Helper()
+	if recorder := serve(t, "POST", "/coupons", coupon, nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected coupon to be created, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`)
+
+	expectProblem(t, serve(t, "GET", "/coupons/missing", "", nil), http.StatusNotFound, "coupon_not_found")
+
+	body := expectProblem(t, serve(t, "POST", "/coupons", `{"id": "2", "colour": "red"}`, nil), http.StatusBadRequest, "invalid_request_body")
+	if body.Details["cause"] == nil {
+		t.Fatalf("Expected the decode error as the cause, got %+v", body)
+	}
+
+	body = expectProblem(t, serve(t, "POST", "/coupons", `{"id": "2"}`, nil), http.StatusBadRequest, "type_required")
+	if body.Field != "type" {
+		t.Fatalf("Expected the type field to be named, got %+v", body)
+	}
+
+	expectProblem(t, serve(t, "POST", "/coupons", `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`, nil),
+		http.StatusConflict, "coupon_exists")
+
+	cart := `{"cart": {"items": [{"product_id": "A123", "quantity": 1, "price": 50}]}}`
+	expectProblem(t, serve(t, "POST", "/apply-coupon/1", cart, nil), http.StatusUnprocessableEntity, "below_threshold")
+
+	header := http.Header{"Content-Type": {"text/plain"}, "If-Match": {"*"}}
+	expectProblem(t, serve(t, "PATCH", "/coupons/1", `{}`, header), http.StatusUnsupportedMediaType, "unsupported_media_type")
+}
+
+func TestProblemResponses_BodyTooLarge(t *testing.T) {
+	setup(t)
+	maxBodyBytes := controllers.MaxBodyBytes
+	controllers.MaxBodyBytes = 16
+	defer func() { controllers.MaxBodyBytes = maxBodyBytes }()
+
+	recorder := serve(t, "POST", "/coupons", `{"id": "1", "type": "cart-wise"}`, nil)
+	expectProblem(t, recorder, http.StatusRequestEntityTooLarge, "request_too_large")
+}
+
+func TestProblemResponses_NotReady(t *testing.T) {
+	setup(t)
+	controllers.SetReadiness(controllers.Starting)
+	defer controllers.SetReadiness(controllers.Ready)
+
+	recorder := serve(t, "GET", "/coupons", "", nil)
+	expectProblem(t, recorder, http.StatusServiceUnavailable, "not_ready")
+	if recorder.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Expected Retry-After 1, got %q", recorder.Header().Get("Retry-After"))
+	}
+}
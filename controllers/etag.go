@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"coupon/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// neverMatches is passed to the store when If-Match names a tag that cannot belong to any
+// coupon version, so the mutation fails with 412 instead of being applied.
+const neverMatches = -1
+
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion reads the coupon version a mutation is conditioned on. If-Match is
+// required; "*" matches any version, and weak tags never match since If-Match uses strong
+// comparison. When several tags are listed the one naming the coupon's current version is
+// used; the store still checks it, so a concurrent change fails with 412.
+func ifMatchVersion(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, &services.Error{
+			Kind:    services.ErrPreconditionRequired,
+			Code:    "if_match_required",
+			Field:   "If-Match",
+			Message: "If-Match header with the coupon's ETag is required",
+		}
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return services.AnyVersion, nil
+		}
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 2 {
+			continue
+		}
+		if version, err := strconv.Atoi(strings.Trim(tag, `"`)); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+
+	switch len(versions) {
+	case 0:
+		return neverMatches, nil
+	case 1:
+		return versions[0], nil
+	}
+	coupon, err := services.GetTenantCoupon(tenantOf(r), mux.Vars(r)["id"])
+	if err != nil {
+		return 0, err
+	}
+	for _, version := range versions {
+		if version == coupon.Version {
+			return version, nil
+		}
+	}
+	return versions[0], nil
+}
+
+// optionalIfMatchVersion is ifMatchVersion for mutations that may also be made
+// unconditionally, such as lifecycle transitions.
+func optionalIfMatchVersion(r *http.Request) (int, error) {
+	if r.Header.Get("If-Match") == "" {
+		return services.AnyVersion, nil
+	}
+	return ifMatchVersion(r)
+}
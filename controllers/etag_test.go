@@ -0,0 +1,56 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	setup(t)
+	coupon := `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`
+	createCoupon(t, coupon)
+
+	recorder := serve(t, "GET", "/coupons/1", "", nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected ETag \"1\", got %d %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+
+	body := expectProblem(t, serve(t, "PUT", "/coupons/1", coupon, nil), http.StatusPreconditionRequired, "if_match_required")
+	if body.Field != "If-Match" {
+		t.Fatalf("Expected the If-Match header to be named, got %+v", body)
+	}
+	expectProblem(t, serve(t, "DELETE", "/coupons/1", "", nil), http.StatusPreconditionRequired, "if_match_required")
+
+	for _, ifMatch := range []string{`"2"`, `W/"1"`, `1`, `"7", "8"`} {
+		header := http.Header{"If-Match": {ifMatch}}
+		body := expectProblem(t, serve(t, "PUT", "/coupons/1", coupon, header), http.StatusPreconditionFailed, "version_mismatch")
+		if body.Details["current_version"] != float64(1) {
+			t.Fatalf("Expected the current version for If-Match %s, got %+v", ifMatch, body)
+		}
+	}
+
+	recorder = serve(t, "PUT", "/coupons/1", coupon, http.Header{"If-Match": {`"7", "1"`}})
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected update to version 2, got %d %q: %s", recorder.Code, recorder.Header().Get("ETag"), recorder.Body.String())
+	}
+
+	patch := http.Header{"If-Match": {`"1"`}, "Content-Type": {"application/merge-patch+json"}}
+	expectProblem(t, serve(t, "PATCH", "/coupons/1", `{"details": {"discount": 15}}`, patch), http.StatusPreconditionFailed, "version_mismatch")
+
+	recorder = serve(t, "DELETE", "/coupons/1", "", http.Header{"If-Match": {"*"}})
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected If-Match * to match any version, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestConditionalRequests_OptionalOnTransitions(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`)
+
+	expectProblem(t, serve(t, "POST", "/coupons/1/pause", "", http.Header{"If-Match": {`"5"`}}), http.StatusPreconditionFailed, "version_mismatch")
+
+	recorder := serve(t, "POST", "/coupons/1/pause", "", nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"2"` {
+		t.Fatalf("Expected unconditional pause to version 2, got %d %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Readiness is where the server is in its lifecycle, as reported by GET /readyz.
+type Readiness int32
+
+const (
+	// Starting is the state until the stores have been loaded.
+	Starting Readiness = iota
+	Ready
+	// Draining is the state once shutdown has begun; in-flight requests are still served.
+	Draining
+)
+
+func (r Readiness) String() string {
+	switch r {
+	case Ready:
+		return "ready"
+	case Draining:
+		return "draining"
+	default:
+		return "starting"
+	}
+}
+
+var readiness atomic.Int32
+
+// SetReadiness records the server's lifecycle state.
+func SetReadiness(state Readiness) {
+	readiness.Store(int32(state))
+}
+
+func currentReadiness() Readiness {
+	return Readiness(readiness.Load())
+}
+
+// Healthz reports that the process is alive and serving HTTP.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, r, http.StatusOK, map[string]interface{}{"status": "ok"})
+}
+
+// Readyz reports whether the server should receive traffic: it fails while the stores are
+// still loading and once draining has begun.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	state := currentReadiness()
+	status := http.StatusOK
+	if state != Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeStatus(w, r, status, map[string]interface{}{"status": state.String()})
+}
+
+// Version reports the build information embedded by the Go toolchain.
+func Version(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		writeStatus(w, r, http.StatusOK, map[string]interface{}{"version": "unknown"})
+		return
+	}
+
+	body := map[string]interface{}{
+		"module":     info.Main.Path,
+		"version":    info.Main.Version,
+		"go_version": info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			body["revision"] = setting.Value
+		case "vcs.time":
+			body["revision_time"] = setting.Value
+		case "vcs.modified":
+			body["modified"] = setting.Value == "true"
+		}
+	}
+	writeStatus(w, r, http.StatusOK, body)
+}
+
+// RequireReady rejects API requests with 503 until the stores have been loaded, so no
+// request reads or writes the empty stores that are replaced once loading finishes.
+func RequireReady(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if currentReadiness() == Starting {
+			w.Header().Set("Retry-After", "1")
+			handleError(w, services.ErrNotReady)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeStatus(w http.ResponseWriter, r *http.Request, status int, body map[string]interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+	}
+}
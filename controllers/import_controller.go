@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// ImportCoupons creates coupons from a CSV file or a JSON array, chosen by Content-Type.
+// The response lists the outcome of every row; with ?dry_run=true nothing is created.
+func ImportCoupons(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	dryRun, err := boolParam(values.Get("dry_run"), "dry_run")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	rows, err := readImport(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	result, err := services.ImportCoupons(tenantOf(r), rows, values.Get("mode"), dryRun != nil && *dryRun, actorFrom(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if result.Created > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+	}
+}
+
+func readImport(r *http.Request) ([]services.CouponRow, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var (
+		rows []services.CouponRow
+		err  error
+	)
+	switch mediaType {
+	case "text/csv":
+		rows, err = services.ReadCouponsCSV(r.Body, services.TenantLocation(tenantOf(r)))
+	case "application/json", "":
+		rows, err = services.ReadCouponsJSON(r.Body)
+	default:
+		return nil, &services.Error{
+			Kind:    services.ErrUnsupported,
+			Code:    "unsupported_media_type",
+			Message: "import requires Content-Type text/csv or application/json",
+		}
+	}
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, invalidBody(err)
+	}
+	return rows, nil
+}
+
+// ExportCoupons streams the tenant's coupons as a JSON array or, with ?format=csv, as CSV
+// with the columns ImportCoupons reads.
+func ExportCoupons(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json":
+		exportJSON(w, r)
+	case "csv":
+		exportCSV(w, r)
+	default:
+		handleError(w, invalidParam("format", "format must be json or csv"))
+	}
+}
+
+func exportCSV(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="coupons.csv"`)
+	csvWriter := csv.NewWriter(w)
+	written := 0
+
+	err := csvWriter.Write(services.CouponCSVHeader())
+	if err == nil {
+		err = services.ExportCoupons(tenantOf(r), func(coupon models.Coupon) error {
+			if err := csvWriter.Write(services.CouponCSVRecord(coupon)); err != nil {
+				return err
+			}
+			written++
+			if written%codeFlushInterval == 0 {
+				csvWriter.Flush()
+				flush(w)
+				return csvWriter.Error()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		csvWriter.Flush()
+		err = csvWriter.Error()
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to stream coupon export", "error", err)
+	}
+}
+
+func exportJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="coupons.json"`)
+	written := 0
+
+	_, err := fmt.Fprint(w, "[")
+	if err == nil {
+		err = services.ExportCoupons(tenantOf(r), func(coupon models.Coupon) error {
+			encoded, err := json.Marshal(coupon)
+			if err != nil {
+				return err
+			}
+			if written > 0 {
+				encoded = append([]byte(",\n"), encoded...)
+			}
+			if _, err := w.Write(encoded); err != nil {
+				return err
+			}
+			written++
+			if written%codeFlushInterval == 0 {
+				flush(w)
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		_, err = fmt.Fprintln(w, "]")
+	}
+	if err != nil {
+		requestLogger(r).Error("failed to stream coupon export", "error", err)
+	}
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
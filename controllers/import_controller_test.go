@@ -0,0 +1,83 @@
+package controllers_test
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExportImportCSV(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "code": "SAVE10", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`)
+	createCoupon(t, `{"id": "2", "type": "product-wise", "details": {"product_id": "A123", "discount": 20, "max_uses": 5}}`)
+
+	recorder := serve(t, "GET", "/coupons/export?format=csv", "", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Content-Type") != "text/csv" || recorder.Header().Get("Content-Disposition") != `attachment; filename="coupons.csv"` {
+		t.Fatalf("Expected a CSV attachment, got %v", recorder.Header())
+	}
+	export := recorder.Body.String()
+	records, err := csv.NewReader(strings.NewReader(export)).ReadAll()
+	if err != nil || len(records) != 3 || records[0][0] != "id" || records[1][0] != "1" || records[2][0] != "2" {
+		t.Fatalf("Expected a header and both coupons in ID order, got %v, %v", records, err)
+	}
+
+	setup(t)
+	header := http.Header{"Content-Type": {"text/csv; charset=utf-8"}}
+	recorder = serve(t, "POST", "/coupons/import?dry_run=true", export, header)
+	if recorder.Code != http.StatusOK || len(services.Coupons) != 0 {
+		t.Fatalf("Expected a dry run to create nothing, got %d with %d coupons", recorder.Code, len(services.Coupons))
+	}
+
+	recorder = serve(t, "POST", "/coupons/import", export, header)
+	var result models.CouponImportResult
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil || recorder.Code != http.StatusCreated || result.Created != 2 {
+		t.Fatalf("Expected both coupons to be created, got %d %+v, %v", recorder.Code, result, err)
+	}
+	if recorder := serve(t, "GET", "/coupons/1", "", nil); recorder.Code != http.StatusOK || recorder.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected the imported coupon at version 1, got %d %q", recorder.Code, recorder.Header().Get("ETag"))
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}`)
+
+	recorder := serve(t, "GET", "/coupons/export", "", nil)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON export, got %d %v", recorder.Code, recorder.Header())
+	}
+	var coupons []models.Coupon
+	if err := json.NewDecoder(recorder.Body).Decode(&coupons); err != nil || len(coupons) != 1 || coupons[0].ID != "1" {
+		t.Fatalf("Expected one exported coupon, got %+v, %v", coupons, err)
+	}
+
+	expectProblem(t, serve(t, "GET", "/coupons/export?format=xml", "", nil), http.StatusBadRequest, "invalid_parameter")
+}
+
+func TestImportErrors(t *testing.T) {
+	setup(t)
+
+	header := http.Header{"Content-Type": {"application/xml"}}
+	expectProblem(t, serve(t, "POST", "/coupons/import", "<coupons/>", header), http.StatusUnsupportedMediaType, "unsupported_media_type")
+
+	rows := `[{"id": "1", "type": "cart-wise", "details": {"threshold": 100, "discount": 10, "max_uses": 5}}, {"id": "2"}]`
+	body := expectProblem(t, serve(t, "POST", "/coupons/import", rows, nil), http.StatusBadRequest, "import_rejected")
+	if body.Details["invalid"] != float64(1) || body.Details["rows"] == nil {
+		t.Fatalf("Expected the invalid rows in details, got %+v", body)
+	}
+	if len(services.Coupons) != 0 {
+		t.Fatalf("Expected nothing to be imported, got %d coupons", len(services.Coupons))
+	}
+
+	recorder := serve(t, "POST", "/coupons/import?mode=best_effort", rows, nil)
+	if recorder.Code != http.StatusCreated || len(services.Coupons) != 1 {
+		t.Fatalf("Expected the valid row to be created, got %d with %d coupons", recorder.Code, len(services.Coupons))
+	}
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"context"
+	"coupon/services"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKey struct{}
+
+// RequestID propagates the caller's X-Request-ID, or assigns a new one when it is missing
+// or malformed, and echoes it in the response so logs on both sides can be correlated.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// validRequestID accepts printable ASCII without spaces, so IDs cannot break log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// requestIDOf is the ID assigned by RequestID; it is empty for requests that did not pass
+// through it.
+func requestIDOf(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestLogger returns the default logger with the request's ID attached.
+func requestLogger(r *http.Request) *slog.Logger {
+	return slog.Default().With("request_id", requestIDOf(r))
+}
+
+// probeRoutes are polled by the orchestrator. Successful probes are only logged at debug
+// level and failed ones at info level, since a failing /readyz is expected while starting
+// or draining.
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// logRequest writes the access log line for a finished request. Server errors are logged
+// at error level and rejections at warn level, together with their error code.
+func logRequest(r *http.Request, route string, recorder *statusRecorder, latency time.Duration) {
+	level := slog.LevelInfo
+	switch {
+	case probeRoutes[route]:
+		if recorder.status < http.StatusBadRequest {
+			level = slog.LevelDebug
+		}
+	case recorder.status >= http.StatusInternalServerError:
+		level = slog.LevelError
+	case recorder.status >= http.StatusBadRequest:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("request_id", requestIDOf(r)),
+		slog.String("method", r.Method),
+		slog.String("route", route),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", recorder.status),
+		slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+		slog.String("client_ip", clientIP(r)),
+	}
+	if id := mux.Vars(r)["id"]; id != "" {
+		key := "coupon_id"
+		if strings.HasPrefix(route, "/customers/") {
+			key = "customer_id"
+		}
+		attrs = append(attrs, slog.String(key, id))
+	}
+	if recorder.err != nil {
+		attrs = append(attrs, slog.String("code", errorCode(recorder.err)), slog.String("error", recorder.err.Error()))
+	}
+	slog.LogAttrs(r.Context(), level, "request", attrs...)
+}
+
+// errorCode is the stable code a service error is reported with.
+func errorCode(err error) string {
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		return serviceErr.Code
+	}
+	return "internal_error"
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"coupon/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec(metrics.Default, "coupon_http_requests_total",
+		"HTTP requests served, by method, route and status code.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec(metrics.Default, "coupon_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by method and route.", metrics.DefaultBuckets, "method", "route")
+)
+
+// GetMetrics serves every metric in the Prometheus text exposition format.
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics.Default.Handler()(w, r)
+}
+
+// statusRecorder remembers the status code a handler wrote and the error it reported
+// through handleError.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	err    error
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(body []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(body)
+}
+
+// Flush keeps streamed responses such as the CSV export flushing through the recorder.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Instrument counts requests and their latency per route and writes the access log.
+// Routes are labelled by their template, such as /coupons/{id}, so coupon IDs do not each
+// become a series.
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		latency := time.Since(start)
+		httpRequests.Inc(r.Method, route, strconv.Itoa(recorder.status))
+		httpDuration.Observe(latency.Seconds(), r.Method, route)
+		logRequest(r, route, recorder, latency)
+	})
+}
+
+// routeTemplate is the path template of the route a request matched.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit refuses requests from locked-out clients, throttles limited routes per
+// client, and charges rejected credentials and "coupon not found" responses to the
+// failure budget that locks guessing clients out. It runs before RequireScope so
+// rejected credentials count as failures too.
+func RateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := services.RateLimits
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		r, principal, err := authenticateOnce(r)
+		if err != nil {
+			principal = models.Principal{}
+		}
+		client := rateLimitClient(r, principal)
+		status, err := limiter.Allow(routeTemplate(r), client, time.Now())
+		if status.Limit > 0 {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(status.ResetAfter))
+		}
+		if err != nil {
+			var serviceErr *services.Error
+			if errors.As(err, &serviceErr) {
+				if retryAfter, ok := serviceErr.Details["retry_after"].(int); ok {
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				}
+			}
+			handleError(w, err)
+			return
+		}
+
+		next(w, r)
+		if recorder, ok := w.(*statusRecorder); ok && failedAttempt(recorder.err) {
+			limiter.RecordFailure(client, time.Now())
+		}
+	}
+}
+
+// rateLimitClient names the client a request is charged to: the shopper a bearer token
+// was issued to, or else the client IP. API keys are never charged, since one storefront
+// key serves every shopper, and customer IDs sent in the body are never used, since
+// anyone could name someone else's.
+func rateLimitClient(r *http.Request, principal models.Principal) string {
+	if principal.Customer != "" {
+		return "customer:" + principal.Tenant + "/" + principal.Customer
+	}
+	return "ip:" + clientIP(r)
+}
+
+// failedAttempt reports whether err is a guess that missed: an unknown coupon, or an API
+// key or token that was rejected. Requests without credentials, and callers refused a
+// scope they do not hold, are not charged.
+func failedAttempt(err error) bool {
+	return errors.Is(err, services.ErrCouponNotFound) ||
+		errors.Is(err, services.ErrInvalidCredentials) ||
+		errors.Is(err, services.ErrInvalidToken)
+}
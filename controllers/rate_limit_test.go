@@ -0,0 +1,212 @@
+package controllers_test
+
+import (
+	"coupon/controllers"
+	"coupon/models"
+	"coupon/services"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	attacker = "198.51.100.1:1234"
+	shopper  = "203.0.113.7:1234"
+)
+
+func useRateLimits(t *testing.T, config models.RateLimitConfig) {
+	t.Helper()
+	limiter, err := services.NewRateLimiter(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	services.RateLimits = limiter
+}
+
+func applyCode(code, customer string) string {
+	return fmt.Sprintf(`{"code": %q, "cart": {"customer": {"id": %q}, "items": [{"product_id": "A123", "quantity": 1, "price": 150}]}}`, code, customer)
+}
+
+func TestRateLimit_Throttles(t *testing.T) {
+	setup(t)
+	useRateLimits(t, models.RateLimitConfig{
+		Routes: map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 60, Burst: 2}},
+	})
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "code": "SAVE10", "details": {"threshold": 100, "discount": 10, "max_uses": 10}}`)
+
+	for i := 0; i < 2; i++ {
+		recorder := serve(t, "POST", "/apply-code", applyCode("SAVE10", ""), nil)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to be allowed, got %d: %s", i+1, recorder.Code, recorder.Body.String())
+		}
+		if recorder.Header().Get("RateLimit-Limit") != "2" || recorder.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatalf("Expected limit 2 with %d remaining, got %v", 1-i, recorder.Header())
+		}
+		if recorder.Header().Get("RateLimit-Reset") == "" {
+			t.Fatalf("Expected RateLimit-Reset, got %v", recorder.Header())
+		}
+	}
+
+	recorder := serve(t, "POST", "/apply-code", applyCode("SAVE10", ""), nil)
+	expectProblem(t, recorder, http.StatusTooManyRequests, "rate_limited")
+	if recorder.Header().Get("Retry-After") != "1" || recorder.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("Expected Retry-After 1 and none remaining, got %v", recorder.Header())
+	}
+
+	if recorder := serveFrom(t, shopper, "POST", "/apply-code", applyCode("SAVE10", ""), nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected another client to have its own bucket, got %d", recorder.Code)
+	}
+	if recorder := serve(t, "GET", "/coupons/1", "", nil); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Fatalf("Expected unlimited route without RateLimit headers, got %d %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestRateLimit_LocksOutGuessing(t *testing.T) {
+	setup(t)
+	useRateLimits(t, models.RateLimitConfig{
+		Routes:   map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 600, Burst: 100}},
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 600, LockoutSeconds: 900},
+	})
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "code": "SAVE10", "details": {"threshold": 100, "discount": 10, "max_uses": 10}}`)
+
+	// The attacker names the shopper's customer ID in every guess.
+	for i := 0; i < 3; i++ {
+		expectProblem(t, serveFrom(t, attacker, "POST", "/apply-code", applyCode(fmt.Sprintf("GUESS%d", i), "victim"), nil), http.StatusNotFound, "coupon_not_found")
+	}
+
+	recorder := serveFrom(t, attacker, "POST", "/apply-code", applyCode("SAVE10", "victim"), nil)
+	body := expectProblem(t, recorder, http.StatusTooManyRequests, "locked_out")
+	retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 899 || retryAfter > 900 || body.Details["retry_after"] != float64(retryAfter) {
+		t.Fatalf("Expected Retry-After of about 900 seconds, got %q and %+v", recorder.Header().Get("Retry-After"), body)
+	}
+	expectProblem(t, serveFrom(t, attacker, "GET", "/coupons/1", "", nil), http.StatusTooManyRequests, "locked_out")
+
+	if recorder := serveFrom(t, shopper, "POST", "/apply-code", applyCode("SAVE10", "victim"), nil); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the named customer not to be locked out, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRateLimit_LocksOutRejectedCredentials(t *testing.T) {
+	setup(t)
+	useAPIKeys(t, models.APIKey{ID: "storefront", Hash: services.HashAPIKey("storefront-key"), Scopes: []string{services.ScopeCartsApply}})
+	useRateLimits(t, models.RateLimitConfig{
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 600, LockoutSeconds: 900},
+	})
+
+	// Requests without credentials are not charged.
+	for i := 0; i < 3; i++ {
+		expectProblem(t, serve(t, "GET", "/tenant", "", nil), http.StatusUnauthorized, "credentials_required")
+	}
+
+	for i := 0; i < 3; i++ {
+		header := http.Header{"X-Api-Key": {fmt.Sprintf("guess-%d", i)}}
+		expectProblem(t, serve(t, "GET", "/tenant", "", header), http.StatusUnauthorized, "invalid_credentials")
+	}
+	header := http.Header{"X-Api-Key": {"storefront-key"}}
+	expectProblem(t, serve(t, "POST", "/apply-code", applyCode("SAVE10", ""), header), http.StatusTooManyRequests, "locked_out")
+
+	if recorder := serveFrom(t, shopper, "POST", "/apply-code", applyCode("SAVE10", ""), header); recorder.Code != http.StatusNotFound {
+		t.Fatalf("Expected the key to work from another client, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRateLimit_ThrottlesTokenCustomer(t *testing.T) {
+	setup(t)
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "code": "SAVE10", "details": {"threshold": 100, "discount": 10, "max_uses": 10}}`)
+	verifier := services.NewJWTVerifier("")
+	verifier.AddHMACKey("", []byte("shared-secret"))
+	services.BearerTokens = verifier
+	useRateLimits(t, models.RateLimitConfig{
+		Routes: map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 60, Burst: 1}},
+	})
+
+	token := func(caller, customer string) http.Header {
+		return bearer(hs256Token(t, "shared-secret", map[string]interface{}{
+			"sub": caller, "roles": []string{services.RoleStorefront}, "customer_id": customer, "exp": time.Now().Add(time.Hour).Unix(),
+		}))
+	}
+
+	if recorder := serveFrom(t, shopper, "POST", "/apply-code", applyCode("SAVE10", ""), token("kiosk-1", "c1")); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected no error, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	// The customer named by the token shares one bucket across callers and clients.
+	expectProblem(t, serveFrom(t, attacker, "POST", "/apply-code", applyCode("SAVE10", ""), token("kiosk-2", "c1")), http.StatusTooManyRequests, "rate_limited")
+	if recorder := serveFrom(t, attacker, "POST", "/apply-code", applyCode("SAVE10", ""), token("kiosk-3", "c2")); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected other customers to have their own bucket, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestRateLimit_ChargesForwardedClients(t *testing.T) {
+	setup(t)
+	proxies := controllers.TrustedProxies
+	controllers.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	defer func() { controllers.TrustedProxies = proxies }()
+	createCoupon(t, `{"id": "1", "type": "cart-wise", "code": "SAVE10", "details": {"threshold": 100, "discount": 10, "max_uses": 10}}`)
+	useAPIKeys(t, models.APIKey{ID: "storefront", Hash: services.HashAPIKey("storefront-key"), Scopes: []string{services.ScopeCartsApply}})
+	useRateLimits(t, models.RateLimitConfig{
+		Routes:   map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 600, Burst: 100}},
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 600, LockoutSeconds: 900},
+	})
+
+	// Every shopper reaches the API through the storefront's one key and one proxy.
+	from := func(client string) http.Header {
+		return http.Header{"X-Api-Key": {"storefront-key"}, "X-Forwarded-For": {client + ", 10.0.0.9"}}
+	}
+	for i := 0; i < 3; i++ {
+		expectProblem(t, serveFrom(t, "10.0.0.5:1234", "POST", "/apply-code", applyCode(fmt.Sprintf("GUESS%d", i), ""), from("198.51.100.1")), http.StatusNotFound, "coupon_not_found")
+	}
+	expectProblem(t, serveFrom(t, "10.0.0.5:1234", "POST", "/apply-code", applyCode("SAVE10", ""), from("198.51.100.1")), http.StatusTooManyRequests, "locked_out")
+
+	if recorder := serveFrom(t, "10.0.0.5:1234", "POST", "/apply-code", applyCode("SAVE10", ""), from("203.0.113.7")); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected other shoppers behind the same key and proxy to be served, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// An untrusted peer cannot pick its address with X-Forwarded-For.
+	spoofed := http.Header{"X-Api-Key": {"storefront-key"}, "X-Forwarded-For": {"203.0.113.7"}}
+	for i := 0; i < 3; i++ {
+		serveFrom(t, attacker, "POST", "/apply-code", applyCode(fmt.Sprintf("GUESS%d", i), ""), spoofed)
+	}
+	expectProblem(t, serveFrom(t, attacker, "POST", "/apply-code", applyCode("SAVE10", ""), spoofed), http.StatusTooManyRequests, "locked_out")
+	if recorder := serveFrom(t, "10.0.0.5:1234", "POST", "/apply-code", applyCode("SAVE10", ""), from("203.0.113.7")); recorder.Code != http.StatusOK {
+		t.Fatalf("Expected the spoofed address not to be locked out, got %d", recorder.Code)
+	}
+}
+
+func TestRateLimit_ScopeRejectionsAreNotCharged(t *testing.T) {
+	setup(t)
+	useAPIKeys(t, models.APIKey{ID: "storefront", Hash: services.HashAPIKey("storefront-key"), Scopes: []string{services.ScopeCartsApply}})
+	useRateLimits(t, models.RateLimitConfig{
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 600, LockoutSeconds: 900},
+	})
+
+	header := http.Header{"X-Api-Key": {"storefront-key"}}
+	for i := 0; i < 4; i++ {
+		expectProblem(t, serve(t, "GET", "/coupons", "", header), http.StatusForbidden, "insufficient_scope")
+	}
+	expectProblem(t, serve(t, "POST", "/apply-code", applyCode("SAVE10", ""), header), http.StatusNotFound, "coupon_not_found")
+}
+
+func TestRateLimit_LocksOutTokenCustomer(t *testing.T) {
+	setup(t)
+	verifier := services.NewJWTVerifier("")
+	verifier.AddHMACKey("", []byte("shared-secret"))
+	services.BearerTokens = verifier
+	useRateLimits(t, models.RateLimitConfig{
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 600, LockoutSeconds: 900},
+	})
+
+	token := func(customer string) http.Header {
+		return bearer(hs256Token(t, "shared-secret", map[string]interface{}{
+			"sub": "storefront", "roles": []string{services.RoleStorefront}, "customer_id": customer, "exp": time.Now().Add(time.Hour).Unix(),
+		}))
+	}
+	for i := 0; i < 3; i++ {
+		expectProblem(t, serve(t, "POST", "/apply-code", applyCode(fmt.Sprintf("GUESS%d", i), ""), token("c1")), http.StatusNotFound, "coupon_not_found")
+	}
+	expectProblem(t, serveFrom(t, shopper, "POST", "/apply-code", applyCode("SAVE10", ""), token("c1")), http.StatusTooManyRequests, "locked_out")
+	expectProblem(t, serve(t, "POST", "/apply-code", applyCode("SAVE10", ""), token("c2")), http.StatusNotFound, "coupon_not_found")
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+)
+
+func GetRedemptions(w http.ResponseWriter, r *http.Request) {
+	query, err := parseRedemptionQuery(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	redemptions, err := services.QueryRedemptions(query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"redemptions": redemptions,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func GetRedemptionReport(w http.ResponseWriter, r *http.Request) {
+	query, err := parseRedemptionQuery(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	report, err := services.GetRedemptionReport(query)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
+
+func GetTopCoupons(w http.ResponseWriter, r *http.Request) {
+	query, err := parseRedemptionQuery(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	coupons, err := services.GetTopCoupons(query, r.URL.Query().Get("sort"))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"coupons": coupons,
+	}); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
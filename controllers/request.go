@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"coupon/models"
+	"coupon/services"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// MaxBodyBytes caps the size of every request body. It is set from the server
+// configuration before the router is built.
+var MaxBodyBytes int64 = 1 << 20
+
+// TrustedProxies are the proxies whose X-Forwarded-For header names the client. It is
+// set from the server configuration; without it the peer address is the client.
+var TrustedProxies []netip.Prefix
+
+// cartRequest is the body shared by every endpoint that prices a cart. Setting Normalize
+// merges duplicate product lines instead of rejecting them.
+type cartRequest struct {
+	Cart      models.Cart `json:"cart"`
+	Normalize bool        `json:"normalize,omitempty"`
+
+	normalization *models.CartNormalization
+}
+
+// decodeStrict decodes a JSON body and rejects fields the target type does not define,
+// so typos in coupon definitions fail loudly instead of being dropped.
+func decodeStrict(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// decodeCart reads a size-limited body into body, binds the cart to the shopper named by
+// the caller's token, then validates (and optionally normalizes) the cartRequest embedded
+// in it.
+func decodeCart(w http.ResponseWriter, r *http.Request, body interface{}, request *cartRequest) error {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+		return invalidBody(err)
+	}
+
+	request.Cart.TenantID = tenantOf(r)
+	if err := bindCartCustomer(r, &request.Cart); err != nil {
+		return err
+	}
+	cart, normalization, err := services.ValidateCart(request.Cart, request.Normalize)
+	if err != nil {
+		return err
+	}
+	request.Cart = cart
+	request.normalization = normalization
+	return nil
+}
+
+// bindCartCustomer makes a token's customer the cart's customer, so a shopper cannot
+// redeem per-customer coupons as someone else. A cart naming another customer is
+// rejected; callers without a customer claim, like storefront keys, name it themselves.
+func bindCartCustomer(r *http.Request, cart *models.Cart) error {
+	principal, ok := principalFrom(r)
+	if !ok || principal.Customer == "" {
+		return nil
+	}
+	if cart.CustomerID != "" && cart.CustomerID != principal.Customer {
+		return services.ErrCustomerMismatch
+	}
+	if cart.Customer != nil {
+		if cart.Customer.ID != "" && cart.Customer.ID != principal.Customer {
+			return services.ErrCustomerMismatch
+		}
+		cart.Customer.ID = principal.Customer
+	}
+	cart.CustomerID = principal.Customer
+	return nil
+}
+
+// readMergePatch returns the raw merge patch document. application/json is accepted
+// alongside application/merge-patch+json for clients that cannot set a custom type.
+func readMergePatch(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			return nil, &services.Error{
+				Kind:    services.ErrUnsupported,
+				Code:    "unsupported_media_type",
+				Message: fmt.Sprintf("PATCH requires Content-Type %s", mergePatchContentType),
+			}
+		}
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	if err != nil {
+		return nil, invalidBody(err)
+	}
+	return patch, nil
+}
+
+// parseCouponQuery reads the filters, sort order and page position of GET /coupons.
+func parseCouponQuery(r *http.Request) (models.CouponQuery, error) {
+	values := r.URL.Query()
+	location := services.TenantLocation(tenantOf(r))
+	query := models.CouponQuery{
+		Tenant:     tenantOf(r),
+		Type:       values.Get("type"),
+		Status:     values.Get("status"),
+		ProductID:  values.Get("product_id"),
+		CodePrefix: values.Get("code_prefix"),
+		Sort:       values.Get("sort"),
+		Cursor:     values.Get("cursor"),
+	}
+
+	var err error
+	if query.Expired, err = boolParam(values.Get("expired"), "expired"); err != nil {
+		return query, err
+	}
+	if query.Exclusive, err = boolParam(values.Get("exclusive"), "exclusive"); err != nil {
+		return query, err
+	}
+	if query.CreatedAfter, err = timeParam(values.Get("created_after"), "created_after", location); err != nil {
+		return query, err
+	}
+	if query.CreatedBefore, err = timeParam(values.Get("created_before"), "created_before", location); err != nil {
+		return query, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, invalidParam("limit", "limit must be a positive integer")
+		}
+	}
+	return query, nil
+}
+
+// parseAuditQuery reads the filters of GET /audit.
+func parseAuditQuery(r *http.Request) (models.AuditQuery, error) {
+	values := r.URL.Query()
+	location := services.TenantLocation(tenantOf(r))
+	query := models.AuditQuery{
+		Tenant:   tenantOf(r),
+		Action:   values.Get("action"),
+		CouponID: values.Get("coupon_id"),
+		ActorID:  values.Get("actor"),
+	}
+
+	var err error
+	if query.Since, err = timeParam(values.Get("since"), "since", location); err != nil {
+		return query, err
+	}
+	if query.Until, err = timeParam(values.Get("until"), "until", location); err != nil {
+		return query, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, invalidParam("limit", "limit must be a positive integer")
+		}
+	}
+	return query, nil
+}
+
+// parseRedemptionQuery reads the filters of the redemption ledger and reports.
+func parseRedemptionQuery(r *http.Request) (models.RedemptionQuery, error) {
+	values := r.URL.Query()
+	location := services.TenantLocation(tenantOf(r))
+	query := models.RedemptionQuery{
+		Tenant:     tenantOf(r),
+		CouponID:   values.Get("coupon_id"),
+		CustomerID: values.Get("customer_id"),
+		OrderID:    values.Get("order_id"),
+		Interval:   values.Get("interval"),
+	}
+
+	var err error
+	if query.Since, err = timeParam(values.Get("since"), "since", location); err != nil {
+		return query, err
+	}
+	if query.Until, err = timeParam(values.Get("until"), "until", location); err != nil {
+		return query, err
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, invalidParam("limit", "limit must be a positive integer")
+		}
+	}
+	return query, nil
+}
+
+func boolParam(value, name string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, invalidParam(name, name+" must be true or false")
+	}
+	return &parsed, nil
+}
+
+// timeParam reads an RFC 3339 timestamp, or a date, which is taken as midnight in the
+// tenant's timezone.
+func timeParam(value, name string, location *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		if parsed, err = time.ParseInLocation("2006-01-02", value, location); err != nil {
+			return nil, invalidParam(name, name+" must be an RFC 3339 timestamp or a date")
+		}
+	}
+	return &parsed, nil
+}
+
+func invalidParam(name, message string) error {
+	return &services.Error{
+		Kind:    services.ErrInvalid,
+		Code:    "invalid_parameter",
+		Field:   name,
+		Message: message,
+	}
+}
+
+// actorFrom identifies who made a request for the revision history and audit trail.
+// Only an authenticated caller sets the actor ID. X-Actor is kept apart as an unverified
+// claim, so a client cannot pass itself off as someone else.
+func actorFrom(r *http.Request) models.Actor {
+	actor := models.Actor{
+		ClaimedID: strings.TrimSpace(r.Header.Get("X-Actor")),
+		IP:        clientIP(r),
+		RequestID: requestIDOf(r),
+	}
+	if principal, ok := principalFrom(r); ok {
+		actor.ID = principal.ID
+	}
+	return actor
+}
+
+// clientIP is the address of the client a request came from. Behind a trusted proxy it
+// is the last X-Forwarded-For entry that is not itself a trusted proxy, so a client
+// cannot choose its own address by sending the header.
+func clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if split, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = split
+	}
+	if !trustedProxy(host) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break
+		}
+		host = hop
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+func trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	for _, proxy := range TrustedProxies {
+		if proxy.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitBody applies MaxBodyBytes to every request, so bodies that are not read through
+// decodeCart or readMergePatch are capped as well.
+func LimitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"coupon/services"
+	"encoding/json"
+	"net/http"
+)
+
+func GetTenant(w http.ResponseWriter, r *http.Request) {
+	tenant, err := services.ResolveTenant(tenantOf(r))
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(tenant); err != nil {
+		requestLogger(r).Error("failed to encode response", "error", err)
+		http.Error(w, internalServerError, http.StatusInternalServerError)
+	}
+}
@@ -1,5 +1,5 @@
 module coupon
 
-go 1.20
+go 1.21
 
 require github.com/gorilla/mux v1.8.1
@@ -1,13 +1,234 @@
 package main
 
 import (
+	"context"
+	"coupon/config"
+	"coupon/controllers"
 	"coupon/router"
-	"log"
+	"coupon/services"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 func main() {
-	r := router.Router()
-	log.Println("Server is starting... Listening on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	setLogger(slog.LevelInfo)
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	setLogger(cfg.LogLevel)
+
+	if err := run(cfg); err != nil {
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// setLogger makes every log line, including those of the standard log package, a JSON
+// object on stderr.
+func setLogger(level slog.Level) {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// run serves until SIGINT or SIGTERM. The listener starts before the stores are loaded so
+// /healthz answers during a long journal replay, while /readyz and the API return 503
+// until loading finishes. On shutdown /readyz fails for the drain delay, then the server
+// stops accepting connections, lets in-flight requests finish within the shutdown timeout
+// and closes the persistent stores so their pending writes reach disk.
+func run(cfg config.Config) error {
+	if err := configureAuth(cfg); err != nil {
+		return err
+	}
+	controllers.MaxBodyBytes = cfg.MaxBodyBytes
+	proxies, err := cfg.Proxies()
+	if err != nil {
+		return err
+	}
+	controllers.TrustedProxies = proxies
+	controllers.SetReadiness(controllers.Starting)
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           router.Router(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelError),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("server starting", "addr", cfg.Addr, "tls", cfg.TLS())
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLS() {
+			serveErr <- server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	closeStores, err := openStores(cfg)
+	if err != nil {
+		server.Close()
+		return err
+	}
+	defer closeStores()
+	controllers.SetReadiness(controllers.Ready)
+	slog.Info("server ready")
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	controllers.SetReadiness(controllers.Draining)
+	if cfg.DrainDelay > 0 {
+		slog.Info("draining", "delay", cfg.DrainDelay.String())
+		time.Sleep(cfg.DrainDelay)
+	}
+
+	slog.Info("shutting down", "drain_timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// openStores swaps in the file-backed coupon store, order history and audit log when
+// configured. The returned function closes them, writing any pending changes.
+func openStores(cfg config.Config) (func(), error) {
+	var closers []func() error
+
+	if cfg.CouponStoreFile != "" {
+		store, err := services.OpenCouponStore(cfg.CouponStoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load coupon store: %w", err)
+		}
+		closers = append(closers, store.Close)
+		services.CouponStorage = store
+	}
+
+	if cfg.OrderHistoryFile != "" {
+		history, err := services.NewFileOrderHistory(cfg.OrderHistoryFile)
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("failed to load order history: %w", err)
+		}
+		closers = append(closers, history.Close)
+		services.OrderHistory = history
+	}
+
+	if cfg.AuditLogFile != "" {
+		auditLog, err := services.OpenAuditLog(cfg.AuditLogFile, cfg.AuditLogMaxBytes, cfg.AuditLogMaxFiles)
+		if err != nil {
+			closeAll(closers)
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		if err := auditLog.Verify(); err != nil {
+			slog.Error("audit log failed verification", "error", err)
+		}
+		closers = append(closers, auditLog.Close)
+		services.Audit = auditLog
+	}
+
+	return func() { closeAll(closers) }, nil
+}
+
+func closeAll(closers []func() error) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i](); err != nil {
+			slog.Error("failed to close store", "error", err)
+		}
+	}
+}
+
+func configureAuth(cfg config.Config) error {
+	// Tenants are loaded first so API keys can be checked against them.
+	if cfg.TenantsFile != "" {
+		tenants, err := services.LoadTenants(cfg.TenantsFile)
+		if err != nil {
+			return fmt.Errorf("failed to load tenants: %w", err)
+		}
+		services.Tenants = tenants
+	}
+
+	if cfg.APIKeysFile != "" {
+		keys, err := services.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to load API keys: %w", err)
+		}
+		services.APIKeys = keys
+	}
+
+	if cfg.RateLimitsFile != "" {
+		limiter, err := services.LoadRateLimits(cfg.RateLimitsFile)
+		if err != nil {
+			return fmt.Errorf("failed to load rate limits: %w", err)
+		}
+		services.RateLimits = limiter
+	}
+
+	verifier, err := tokenVerifier(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load token keys: %w", err)
+	}
+	services.BearerTokens = verifier
+
+	if services.APIKeys == nil && services.BearerTokens == nil {
+		slog.Warn("neither API keys nor JWT keys are configured; the API is running without authentication")
+	}
+	return nil
+}
+
+// tokenVerifier builds the bearer token verifier from the configured HS256 secret, RSA
+// public key and JWKS file. It returns nil when none of them is set.
+func tokenVerifier(cfg config.Config) (*services.JWTVerifier, error) {
+	if cfg.JWTHS256Secret == "" && cfg.JWTRSAPublicKeyFile == "" && cfg.JWTJWKSFile == "" {
+		return nil, nil
+	}
+
+	verifier := services.NewJWTVerifier(cfg.JWTAudience)
+	if cfg.JWTRolesClaim != "" {
+		verifier.RolesClaim = cfg.JWTRolesClaim
+	}
+	if cfg.JWTTenantClaim != "" {
+		verifier.TenantClaim = cfg.JWTTenantClaim
+	}
+	if cfg.JWTCustomerClaim != "" {
+		verifier.CustomerClaim = cfg.JWTCustomerClaim
+	}
+	if cfg.JWTHS256Secret != "" {
+		verifier.AddHMACKey("", []byte(cfg.JWTHS256Secret))
+	}
+	if cfg.JWTRSAPublicKeyFile != "" {
+		if err := verifier.LoadRSAPublicKey(cfg.JWTRSAPublicKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.JWTJWKSFile != "" {
+		if err := verifier.LoadJWKS(cfg.JWTJWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if verifier.Audience == "" {
+		slog.Warn("JWT audience is not set; bearer tokens are accepted for any audience")
+	}
+	return verifier, nil
 }
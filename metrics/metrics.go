@@ -0,0 +1,285 @@
+// Package metrics implements the counters, gauges and histograms the service exposes and
+// writes them in the Prometheus text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+// Registry is the set of metrics written by Handler.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Default is the registry the service's metrics are registered in.
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, c collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every registered metric in registration order.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mutex.Unlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := r.Write(w); err != nil {
+			http.Error(w, "failed to write metrics", http.StatusInternalServerError)
+		}
+	}
+}
+
+// family holds the series of one metric, keyed by their label values.
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	count       uint64
+}
+
+func newFamily(name, help, kind string, labelNames []string) *family {
+	return &family{name: name, help: help, kind: kind, labelNames: labelNames, series: make(map[string]*series)}
+}
+
+// get returns the series for labelValues, creating it on first use. The caller holds
+// f.mutex.
+func (f *family) get(labelValues []string, buckets int) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...), buckets: make([]uint64, buckets)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns copies of the series in label order, so scrapes are stable.
+func (f *family) sorted() []series {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	all := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		copied := *s
+		copied.buckets = append([]uint64(nil), s.buckets...)
+		all = append(all, copied)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		for k := range all[i].labelValues {
+			if all[i].labelValues[k] != all[j].labelValues[k] {
+				return all[i].labelValues[k] < all[j].labelValues[k]
+			}
+		}
+		return false
+	})
+	return all
+}
+
+func (f *family) header(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	return err
+}
+
+// CounterVec is a monotonically increasing value per combination of labels.
+type CounterVec struct {
+	*family
+}
+
+func NewCounterVec(registry *Registry, name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, "counter", labelNames)}
+	registry.register(name, c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter; negative values are ignored since counters never go down.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 || math.IsNaN(value) {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.get(labelValues, 0).value += value
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := c.header(w); err != nil {
+		return err
+	}
+	for _, s := range c.sorted() {
+		if err := writeSample(w, c.name, c.labelNames, s.labelValues, "", "", s.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HistogramVec counts observations into cumulative buckets per combination of labels.
+type HistogramVec struct {
+	*family
+	upperBounds []float64
+}
+
+func NewHistogramVec(registry *Registry, name, help string, upperBounds []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{family: newFamily(name, help, "histogram", labelNames), upperBounds: upperBounds}
+	registry.register(name, h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := h.get(labelValues, len(h.upperBounds))
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := h.header(w); err != nil {
+		return err
+	}
+	for _, s := range h.sorted() {
+		for i, bound := range h.upperBounds {
+			if err := writeSample(w, h.name+"_bucket", h.labelNames, s.labelValues, "le", formatValue(bound), float64(s.buckets[i])); err != nil {
+				return err
+			}
+		}
+		if err := writeSample(w, h.name+"_bucket", h.labelNames, s.labelValues, "le", "+Inf", float64(s.count)); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_sum", h.labelNames, s.labelValues, "", "", s.value); err != nil {
+			return err
+		}
+		if err := writeSample(w, h.name+"_count", h.labelNames, s.labelValues, "", "", float64(s.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GaugeFunc is a value computed when the metrics are scraped.
+type GaugeFunc struct {
+	*family
+	value func() float64
+}
+
+func NewGaugeFunc(registry *Registry, name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{family: newFamily(name, help, "gauge", nil), value: value}
+	registry.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := g.header(w); err != nil {
+		return err
+	}
+	return writeSample(w, g.name, nil, nil, "", "", g.value())
+}
+
+func writeSample(w io.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) error {
+	var labels []string
+	for i, labelName := range labelNames {
+		labels = append(labels, labelName+`="`+escapeLabel(labelValues[i])+`"`)
+	}
+	if extraName != "" {
+		labels = append(labels, extraName+`="`+extraValue+`"`)
+	}
+
+	line := name
+	if len(labels) > 0 {
+		line += "{" + strings.Join(labels, ",") + "}"
+	}
+	_, err := io.WriteString(w, line+" "+formatValue(value)+"\n")
+	return err
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounterVec(registry, "test_requests_total", "Requests served.", "route", "status")
+	latency := NewHistogramVec(registry, "test_latency_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	NewGaugeFunc(registry, "test_active", "Active things.", func() float64 { return 3 })
+
+	requests.Inc("/coupons/{id}", "200")
+	requests.Add(2, "/coupons/{id}", "200")
+	requests.Inc("/coupons", "404")
+	requests.Add(-1, "/coupons", "404")
+	latency.Observe(0.05, "/coupons")
+	latency.Observe(0.5, "/coupons")
+	latency.Observe(5, "/coupons")
+
+	var output bytes.Buffer
+	if err := registry.Write(&output); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{route="/coupons",status="404"} 1
+test_requests_total{route="/coupons/{id}",status="200"} 3
+# HELP test_latency_seconds Request latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/coupons",le="0.1"} 1
+test_latency_seconds_bucket{route="/coupons",le="1"} 2
+test_latency_seconds_bucket{route="/coupons",le="+Inf"} 3
+test_latency_seconds_sum{route="/coupons"} 5.55
+test_latency_seconds_count{route="/coupons"} 3
+# HELP test_active Active things.
+# TYPE test_active gauge
+test_active 3
+`
+	if output.String() != expected {
+		t.Fatalf("Expected exposition\n%s\ngot\n%s", expected, output.String())
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	registry := NewRegistry()
+	counter := NewCounterVec(registry, "test_total", "Help with \\ and\nnewline.", "reason")
+	counter.Inc("say \"hi\"\\\n")
+
+	var output bytes.Buffer
+	if err := registry.Write(&output); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !strings.Contains(output.String(), `# HELP test_total Help with \\ and\nnewline.`) {
+		t.Fatalf("Expected escaped help text, got %s", output.String())
+	}
+	if !strings.Contains(output.String(), `test_total{reason="say \"hi\"\\\n"} 1`) {
+		t.Fatalf("Expected escaped label value, got %s", output.String())
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for value, expected := range map[float64]string{1: "1", 0.25: "0.25", 1e21: "1e+21", math.Inf(1): "+Inf"} {
+		if formatted := formatValue(value); formatted != expected {
+			t.Fatalf("Expected %v to format as %s, got %s", value, expected, formatted)
+		}
+	}
+}
+
+func TestDuplicateMetricPanics(t *testing.T) {
+	registry := NewRegistry()
+	NewCounterVec(registry, "test_total", "Help.")
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected registering a duplicate metric to panic")
+		}
+	}()
+	NewCounterVec(registry, "test_total", "Help.")
+}
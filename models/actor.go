@@ -0,0 +1,10 @@
+package models
+
+// Actor is who made a change. ID is the authenticated caller; ClaimedID is the
+// unverified name the client sent in X-Actor, which anyone can set.
+type Actor struct {
+	ID        string `json:"id,omitempty"`
+	ClaimedID string `json:"claimed_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
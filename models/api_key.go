@@ -0,0 +1,22 @@
+package models
+
+type APIKey struct {
+	ID     string   `json:"id"`
+	Tenant string   `json:"tenant,omitempty"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKeyConfig struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// Principal is an authenticated caller and the scopes it was granted. Tenant is set when
+// the caller's credentials are bound to one tenant, and Customer when they were issued to
+// a shopper.
+type Principal struct {
+	ID       string
+	Tenant   string
+	Customer string
+	Scopes   []string
+}
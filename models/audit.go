@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEntry struct {
+	Sequence     int64           `json:"sequence"`
+	Tenant       string          `json:"tenant,omitempty"`
+	Action       string          `json:"action"`
+	CouponID     string          `json:"coupon_id,omitempty"`
+	Actor        Actor           `json:"actor"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	PreviousHash string          `json:"previous_hash"`
+	Hash         string          `json:"hash"`
+}
+
+type AuditQuery struct {
+	Tenant   string
+	Action   string
+	CouponID string
+	ActorID  string
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+}
@@ -1,6 +1,11 @@
 package models
 
 type Cart struct {
+	TenantID      string     `json:"-"`
+	Currency      string     `json:"currency,omitempty"`
+	OrderID       string     `json:"order_id,omitempty"`
+	CustomerID    string     `json:"customer_id,omitempty"`
+	Customer      *Customer  `json:"customer,omitempty"`
 	Items         []CartItem `json:"items"`
 	TotalPrice    float64    `json:"total_price"`
 	TotalDiscount float64    `json:"total_discount"`
@@ -13,3 +18,9 @@ type CartItem struct {
 	Price         float64 `json:"price"`
 	TotalDiscount float64 `json:"total_discount"`
 }
+
+type CartNormalization struct {
+	LinesBefore    int      `json:"lines_before"`
+	LinesAfter     int      `json:"lines_after"`
+	MergedProducts []string `json:"merged_products"`
+}
@@ -0,0 +1,18 @@
+package models
+
+type GeneratedCode struct {
+	Code     string `json:"code"`
+	TenantID string `json:"-"`
+	CouponID string `json:"coupon_id"`
+	MaxUses  int    `json:"max_uses"`
+	Uses     int    `json:"uses"`
+}
+
+type CodeBatchRequest struct {
+	Count      int    `json:"count"`
+	Pattern    string `json:"pattern,omitempty"`
+	Alphabet   string `json:"alphabet,omitempty"`
+	Prefix     string `json:"prefix,omitempty"`
+	CheckDigit bool   `json:"check_digit,omitempty"`
+	MaxUses    int    `json:"max_uses,omitempty"`
+}
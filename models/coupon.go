@@ -2,25 +2,50 @@ package models
 
 import "time"
 
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusArchived  = "archived"
+)
+
 type Coupon struct {
-	ID      string        `json:"id"`
-	Type    string        `json:"type"`
-	Details CouponDetails `json:"details"`
+	ID        string        `json:"id"`
+	TenantID  string        `json:"-"`
+	Code      string        `json:"code,omitempty"`
+	Aliases   []string      `json:"aliases,omitempty"`
+	Type      string        `json:"type"`
+	Status    string        `json:"status,omitempty"`
+	CodesOnly bool          `json:"codes_only,omitempty"`
+	Details   CouponDetails `json:"details"`
+	Version   int           `json:"version,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
 }
 
 type CouponDetails struct {
-	Threshold        float64      `json:"threshold,omitempty"`
-	Discount         float64      `json:"discount"`
-	ProductID        string       `json:"product_id,omitempty"`
-	BuyProducts      []BuyProduct `json:"buy_products,omitempty"`
-	GetProducts      []GetProduct `json:"get_products,omitempty"`
-	RepetitionLimit  int          `json:"repetition_limit,omitempty"`
-	ExpiryDate       *time.Time   `json:"expiry_date,omitempty"`
-	MaxUses          int          `json:"max_uses,omitempty"`
-	Uses             int          `json:"uses,omitempty"`
-	Exclusive        bool         `json:"exclusive,omitempty"`
-	MinCartValue     float64      `json:"min_cart_value,omitempty"`
-	ExcludedProducts []string     `json:"excluded_products,omitempty"`
+	Threshold             float64      `json:"threshold,omitempty"`
+	Discount              float64      `json:"discount"`
+	ProductID             string       `json:"product_id,omitempty"`
+	BuyProducts           []BuyProduct `json:"buy_products,omitempty"`
+	GetProducts           []GetProduct `json:"get_products,omitempty"`
+	RepetitionLimit       int          `json:"repetition_limit,omitempty"`
+	StartDate             *time.Time   `json:"start_date,omitempty"`
+	ExpiryDate            *time.Time   `json:"expiry_date,omitempty"`
+	MaxUses               int          `json:"max_uses,omitempty"`
+	Uses                  int          `json:"uses,omitempty"`
+	MaxUsesPerCustomer    int          `json:"max_uses_per_customer,omitempty"`
+	Exclusive             bool         `json:"exclusive,omitempty"`
+	MinCartValue          float64      `json:"min_cart_value,omitempty"`
+	ExcludedProducts      []string     `json:"excluded_products,omitempty"`
+	CustomerIDs           []string     `json:"customer_ids,omitempty"`
+	CustomerTiers         []string     `json:"customer_tiers,omitempty"`
+	CustomerTags          []string     `json:"customer_tags,omitempty"`
+	NewCustomersOnly      bool         `json:"new_customers_only,omitempty"`
+	MaxAccountAgeDays     int          `json:"max_account_age_days,omitempty"`
+	FirstOrderOnly        bool         `json:"first_order_only,omitempty"`
+	MinDaysSinceLastOrder int          `json:"min_days_since_last_order,omitempty"`
 }
 
 type BuyProduct struct {
@@ -32,3 +57,23 @@ type GetProduct struct {
 	ProductID string `json:"product_id"`
 	Quantity  int    `json:"quantity"`
 }
+
+type CouponQuery struct {
+	Tenant        string
+	Type          string
+	Status        string
+	Expired       *bool
+	ProductID     string
+	Exclusive     *bool
+	CodePrefix    string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string
+	Limit         int
+	Cursor        string
+}
+
+type CouponPage struct {
+	Coupons    []Coupon `json:"coupons"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// Import modes: all_or_nothing creates no coupon unless every row is valid, best_effort
+// creates the valid rows and reports the rest.
+const (
+	ImportAllOrNothing = "all_or_nothing"
+	ImportBestEffort   = "best_effort"
+)
+
+// Statuses of an imported row.
+const (
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowCreated = "created"
+)
+
+type ImportError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+}
+
+// CouponImportRow reports one row of an import. Row counts from 1 and excludes the CSV
+// header.
+type CouponImportRow struct {
+	Row    int          `json:"row"`
+	ID     string       `json:"id,omitempty"`
+	Status string       `json:"status"`
+	Error  *ImportError `json:"error,omitempty"`
+}
+
+type CouponImportResult struct {
+	Mode    string            `json:"mode"`
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Created int               `json:"created"`
+	Rows    []CouponImportRow `json:"rows"`
+}
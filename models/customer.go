@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Customer struct {
+	ID         string     `json:"id,omitempty"`
+	Tier       string     `json:"tier,omitempty"`
+	Tags       []string   `json:"tags,omitempty"`
+	FirstOrder bool       `json:"first_order,omitempty"`
+	SignupDate *time.Time `json:"signup_date,omitempty"`
+}
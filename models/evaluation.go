@@ -0,0 +1,12 @@
+package models
+
+type CouponEvaluation struct {
+	CouponID        string       `json:"coupon_id"`
+	Type            string       `json:"type"`
+	Discount        float64      `json:"discount,omitempty"`
+	Reason          string       `json:"reason,omitempty"`
+	Message         string       `json:"message,omitempty"`
+	Shortfall       float64      `json:"shortfall,omitempty"`
+	MissingProducts []BuyProduct `json:"missing_products,omitempty"`
+	Hint            string       `json:"hint,omitempty"`
+}
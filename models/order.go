@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Order struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	CustomerID  string    `json:"customer_id"`
+	Total       float64   `json:"total"`
+	CompletedAt time.Time `json:"completed_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// RateLimit is a token bucket: up to Burst requests at once, refilled at
+// RequestsPerMinute.
+type RateLimit struct {
+	RequestsPerMinute float64 `json:"requests_per_minute"`
+	Burst             int     `json:"burst"`
+}
+
+// FailureLimit locks a client out for LockoutSeconds once it has made more than
+// MaxFailures failed lookups within WindowSeconds.
+type FailureLimit struct {
+	MaxFailures    int `json:"max_failures"`
+	WindowSeconds  int `json:"window_seconds"`
+	LockoutSeconds int `json:"lockout_seconds"`
+}
+
+type RateLimitConfig struct {
+	Routes   map[string]RateLimit `json:"routes"`
+	Failures FailureLimit         `json:"failures"`
+}
+
+// RateLimitStatus is the state of the bucket a request drew from. Limit is zero when the
+// route is not limited.
+type RateLimitStatus struct {
+	Limit      int
+	Remaining  int
+	ResetAfter int
+}
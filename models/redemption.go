@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+type CustomerRedemption struct {
+	CouponID       string    `json:"coupon_id"`
+	CouponRevision int       `json:"coupon_revision"`
+	CustomerID     string    `json:"customer_id"`
+	RedeemedAt     time.Time `json:"redeemed_at"`
+}
+
+// Redemption is one coupon use recorded in the redemption ledger. Cart is the cart as
+// priced, so OrderValue is its total before the discount.
+type Redemption struct {
+	ID             int       `json:"id"`
+	TenantID       string    `json:"-"`
+	CouponID       string    `json:"coupon_id"`
+	CouponType     string    `json:"coupon_type"`
+	CouponRevision int       `json:"coupon_revision"`
+	Code           string    `json:"code,omitempty"`
+	CustomerID     string    `json:"customer_id,omitempty"`
+	OrderID        string    `json:"order_id,omitempty"`
+	Cart           Cart      `json:"cart"`
+	OrderValue     float64   `json:"order_value"`
+	Discount       float64   `json:"discount"`
+	RedeemedAt     time.Time `json:"redeemed_at"`
+}
+
+// RedemptionQuery filters the ledger. Interval (day or week) only applies to reports.
+type RedemptionQuery struct {
+	Tenant     string
+	CouponID   string
+	CustomerID string
+	OrderID    string
+	Since      *time.Time
+	Until      *time.Time
+	Interval   string
+	Limit      int
+}
+
+// RedemptionSummary aggregates redemptions and compares them with the orders placed
+// without a coupon: AverageOrderValueWithCoupon is the mean cart total after the discount
+// of the redemptions, and AverageOrderValueWithoutCoupon the mean total of the
+// OrdersWithoutCoupon completed orders in the order history that no redemption names.
+type RedemptionSummary struct {
+	Redemptions                    int     `json:"redemptions"`
+	TotalDiscount                  float64 `json:"total_discount"`
+	AverageOrderValueWithCoupon    float64 `json:"average_order_value_with_coupon"`
+	OrdersWithoutCoupon            int     `json:"orders_without_coupon"`
+	AverageOrderValueWithoutCoupon float64 `json:"average_order_value_without_coupon"`
+}
+
+type RedemptionBucket struct {
+	Start time.Time `json:"start"`
+	RedemptionSummary
+}
+
+type RedemptionReport struct {
+	Interval string             `json:"interval"`
+	Buckets  []RedemptionBucket `json:"buckets"`
+	Totals   RedemptionSummary  `json:"totals"`
+}
+
+type CouponRanking struct {
+	CouponID   string `json:"coupon_id"`
+	CouponType string `json:"coupon_type"`
+	RedemptionSummary
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type CouponRevision struct {
+	CouponID  string        `json:"coupon_id"`
+	Revision  int           `json:"revision"`
+	Action    string        `json:"action"`
+	Actor     Actor         `json:"actor"`
+	CreatedAt time.Time     `json:"created_at"`
+	Coupon    Coupon        `json:"coupon"`
+	Diff      []FieldChange `json:"diff,omitempty"`
+}
+
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
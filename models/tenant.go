@@ -0,0 +1,11 @@
+package models
+
+type Tenant struct {
+	ID       string `json:"id"`
+	Currency string `json:"currency"`
+	Timezone string `json:"timezone"`
+}
+
+type TenantConfig struct {
+	Tenants []Tenant `json:"tenants"`
+}
@@ -2,20 +2,63 @@ package router
 
 import (
 	"coupon/controllers"
+	"coupon/services"
+	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 func Router() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(controllers.RequestID, controllers.Instrument, controllers.LimitBody)
 
-	router.HandleFunc("/coupons", controllers.CreateCoupon).Methods("POST")
-	router.HandleFunc("/coupons", controllers.GetAllCoupons).Methods("GET")
-	router.HandleFunc("/coupons/{id}", controllers.GetCouponByID).Methods("GET")
-	router.HandleFunc("/coupons/{id}", controllers.UpdateCoupon).Methods("PUT")
-	router.HandleFunc("/coupons/{id}", controllers.DeleteCoupon).Methods("DELETE")
-	router.HandleFunc("/applicable-coupons", controllers.GetApplicableCoupons).Methods("POST")
-	router.HandleFunc("/apply-coupon/{id}", controllers.ApplyCoupon).Methods("POST")
+	// Probes stay reachable while the server is starting or draining.
+	router.HandleFunc("/healthz", controllers.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", controllers.Readyz).Methods("GET")
+	router.HandleFunc("/version", controllers.Version).Methods("GET")
+
+	api := router.NewRoute().Subrouter()
+	api.Use(controllers.RequireReady)
+
+	// Every API route is rate limited per client, then authenticated, so rejected
+	// credentials count towards the client's lockout.
+	scoped := func(scope string, handler http.HandlerFunc) http.HandlerFunc {
+		return controllers.RateLimit(controllers.RequireScope(scope, handler))
+	}
+	read := func(handler http.HandlerFunc) http.HandlerFunc {
+		return scoped(services.ScopeCouponsRead, handler)
+	}
+	write := func(handler http.HandlerFunc) http.HandlerFunc {
+		return scoped(services.ScopeCouponsWrite, handler)
+	}
+	apply := func(handler http.HandlerFunc) http.HandlerFunc {
+		return scoped(services.ScopeCartsApply, handler)
+	}
+
+	api.HandleFunc("/coupons", write(controllers.CreateCoupon)).Methods("POST")
+	api.HandleFunc("/coupons", read(controllers.GetAllCoupons)).Methods("GET")
+	api.HandleFunc("/coupons/import", write(controllers.ImportCoupons)).Methods("POST")
+	api.HandleFunc("/coupons/export", read(controllers.ExportCoupons)).Methods("GET")
+	api.HandleFunc("/coupons/{id}", read(controllers.GetCouponByID)).Methods("GET")
+	api.HandleFunc("/coupons/{id}", write(controllers.UpdateCoupon)).Methods("PUT")
+	api.HandleFunc("/coupons/{id}", write(controllers.PatchCoupon)).Methods("PATCH")
+	api.HandleFunc("/coupons/{id}", write(controllers.DeleteCoupon)).Methods("DELETE")
+	api.HandleFunc("/coupons/{id}/{action:activate|pause|resume|archive}", write(controllers.TransitionCoupon)).Methods("POST")
+	api.HandleFunc("/coupons/{id}/revisions", read(controllers.GetCouponRevisions)).Methods("GET")
+	api.HandleFunc("/coupons/{id}/rollback", write(controllers.RollbackCoupon)).Methods("POST")
+	api.HandleFunc("/coupons/{id}/codes", write(controllers.GenerateCodes)).Methods("POST")
+	api.HandleFunc("/applicable-coupons", apply(controllers.GetApplicableCoupons)).Methods("POST")
+	api.HandleFunc("/apply-coupon/{id}", apply(controllers.ApplyCoupon)).Methods("POST")
+	api.HandleFunc("/apply-code", apply(controllers.ApplyCouponByCode)).Methods("POST")
+	api.HandleFunc("/orders", scoped(services.ScopeOrdersWrite, controllers.RecordOrder)).Methods("POST")
+	api.HandleFunc("/customers/{id}/redemptions", scoped(services.ScopeCustomersRead, controllers.GetCustomerRedemptions)).Methods("GET")
+	api.HandleFunc("/tenant", read(controllers.GetTenant)).Methods("GET")
+	api.HandleFunc("/audit", scoped(services.ScopeAuditRead, controllers.GetAuditLog)).Methods("GET")
+	api.HandleFunc("/audit/verify", scoped(services.ScopeAuditRead, controllers.VerifyAuditLog)).Methods("GET")
+	api.HandleFunc("/redemptions", scoped(services.ScopeReportsRead, controllers.GetRedemptions)).Methods("GET")
+	api.HandleFunc("/reports/redemptions", scoped(services.ScopeReportsRead, controllers.GetRedemptionReport)).Methods("GET")
+	api.HandleFunc("/reports/top-coupons", scoped(services.ScopeReportsRead, controllers.GetTopCoupons)).Methods("GET")
+	api.HandleFunc("/metrics", scoped(services.ScopeMetricsRead, controllers.GetMetrics)).Methods("GET")
 
 	return router
 }
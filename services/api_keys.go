@@ -0,0 +1,127 @@
+package services
+
+import (
+	"coupon/models"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Scopes an API key can be granted. Each route requires exactly one of them.
+const (
+	ScopeCouponsRead   = "coupons:read"
+	ScopeCouponsWrite  = "coupons:write"
+	ScopeCartsApply    = "carts:apply"
+	ScopeOrdersWrite   = "orders:write"
+	ScopeCustomersRead = "customers:read"
+	ScopeAuditRead     = "audit:read"
+	ScopeMetricsRead   = "metrics:read"
+	ScopeReportsRead   = "reports:read"
+)
+
+var knownScopes = []string{
+	ScopeCouponsRead,
+	ScopeCouponsWrite,
+	ScopeCartsApply,
+	ScopeOrdersWrite,
+	ScopeCustomersRead,
+	ScopeAuditRead,
+	ScopeMetricsRead,
+	ScopeReportsRead,
+}
+
+const apiKeyHashPrefix = "sha256:"
+
+// APIKeys authenticates requests. It is nil when no key file is configured, in which
+// case the API is open.
+var APIKeys *APIKeyStore
+
+// APIKeyStore holds the configured API keys. Only the SHA-256 of each key is stored.
+type APIKeyStore struct {
+	keys []models.APIKey
+}
+
+// LoadAPIKeys reads an API key file of the form
+// {"keys": [{"id": "storefront", "tenant": "acme", "hash": "sha256:<hex>", "scopes": ["carts:apply"]}]}.
+// A key without a tenant may act on any tenant.
+func LoadAPIKeys(path string) (*APIKeyStore, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.APIKeyConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid API key file: %v", err)
+	}
+	return NewAPIKeyStore(config.Keys)
+}
+
+func NewAPIKeyStore(keys []models.APIKey) (*APIKeyStore, error) {
+	ids := make(map[string]bool)
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("API key without an id")
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("duplicate API key id %q", key.ID)
+		}
+		ids[key.ID] = true
+		if key.Tenant != "" {
+			if _, err := ResolveTenant(key.Tenant); err != nil {
+				return nil, fmt.Errorf("API key %q: %v", key.ID, err)
+			}
+		}
+
+		digest, err := hex.DecodeString(strings.TrimPrefix(key.Hash, apiKeyHashPrefix))
+		if !strings.HasPrefix(key.Hash, apiKeyHashPrefix) || err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("API key %q: hash must be sha256: followed by 64 hex digits", key.ID)
+		}
+		for _, scope := range key.Scopes {
+			if !containsString(knownScopes, scope) {
+				return nil, fmt.Errorf("API key %q: unknown scope %q", key.ID, scope)
+			}
+		}
+	}
+	return &APIKeyStore{keys: keys}, nil
+}
+
+// HashAPIKey returns the form an API key is stored in.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return apiKeyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Authenticate finds the key a request presented. Every configured key is compared in
+// constant time so the response time does not reveal how close a guess was.
+func (s *APIKeyStore) Authenticate(key string) (models.Principal, error) {
+	if key == "" {
+		return models.Principal{}, ErrCredentialsRequired
+	}
+
+	hash := []byte(strings.ToLower(HashAPIKey(key)))
+	var principal models.Principal
+	found := false
+	for _, candidate := range s.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(strings.ToLower(candidate.Hash))) == 1 {
+			principal = models.Principal{ID: candidate.ID, Tenant: candidate.Tenant, Scopes: candidate.Scopes}
+			found = true
+		}
+	}
+	if !found {
+		return models.Principal{}, ErrInvalidCredentials
+	}
+	return principal, nil
+}
+
+// Authorize checks that a principal was granted scope.
+func Authorize(principal models.Principal, scope string) error {
+	if !containsString(principal.Scopes, scope) {
+		return ErrInsufficientScope.withDetails(map[string]interface{}{"required_scope": scope})
+	}
+	return nil
+}
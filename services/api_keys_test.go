@@ -0,0 +1,58 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	config := `{"keys": [
+		{"id": "admin", "hash": "` + HashAPIKey("admin-secret") + `", "scopes": ["coupons:read", "coupons:write"]},
+		{"id": "storefront", "hash": "` + HashAPIKey("storefront-secret") + `", "scopes": ["carts:apply"]}
+	]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	principal, err := keys.Authenticate("storefront-secret")
+	if err != nil || principal.ID != "storefront" {
+		t.Fatalf("Expected storefront key, got %+v, %v", principal, err)
+	}
+	if err := Authorize(principal, ScopeCartsApply); err != nil {
+		t.Fatalf("Expected carts:apply to be allowed, got %v", err)
+	}
+	if err := Authorize(principal, ScopeCouponsWrite); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("Expected coupons:write to be forbidden, got %v", err)
+	}
+
+	if _, err := keys.Authenticate(""); !errors.Is(err, ErrCredentialsRequired) {
+		t.Fatalf("Expected missing key to be rejected, got %v", err)
+	}
+	if _, err := keys.Authenticate("guess"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected unknown key to be rejected, got %v", err)
+	}
+}
+
+func TestNewAPIKeyStore_InvalidConfig(t *testing.T) {
+	valid := HashAPIKey("secret")
+	tests := map[string][]models.APIKey{
+		"missing id":    {{Hash: valid}},
+		"duplicate id":  {{ID: "a", Hash: valid}, {ID: "a", Hash: valid}},
+		"plain key":     {{ID: "a", Hash: "secret"}},
+		"unknown scope": {{ID: "a", Hash: valid, Scopes: []string{"coupons:everything"}}},
+	}
+	for name, keys := range tests {
+		if _, err := NewAPIKeyStore(keys); err == nil {
+			t.Errorf("%s: expected configuration to be rejected", name)
+		}
+	}
+}
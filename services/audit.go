@@ -0,0 +1,564 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"coupon/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// Audit is the trail every admin and redemption action is appended to. It defaults to
+// memory only; main swaps in a file-backed log when AUDIT_LOG_FILE is set.
+var Audit = NewAuditLog()
+
+// auditQueueSize is how many entries can wait for the writer before Record blocks.
+const auditQueueSize = 4096
+
+// AuditLog is an append-only, hash-chained list of audit entries. Each entry's hash covers
+// its content and the previous entry's hash, so editing, removing or reordering entries
+// breaks the chain from that point on.
+//
+// Record only queues the entry, so actions audited while couponsMutex is held never wait
+// for the disk. A single writer chains and appends the entries in the order they were
+// queued, and syncs the file once the queue is empty, so a burst of entries shares one
+// fsync. An action therefore takes effect before its entry is durable: a crash loses the
+// entries still queued or written but not yet synced, while Close writes and syncs them
+// all. A file-backed log keeps only the chain head in memory and reads the files for
+// queries and verification, without holding up the writer.
+type AuditLog struct {
+	queue   chan auditRequest
+	stopped chan struct{}
+
+	// closing guards queue against Record calls racing Close.
+	closing sync.RWMutex
+	closed  bool
+
+	// mutex guards the fields below, which only the writer changes.
+	mutex   sync.RWMutex
+	head    models.AuditEntry
+	entries []models.AuditEntry
+	file    *rotatingFile
+}
+
+// auditRequest is an entry for the writer, or a barrier when done is set: the writer
+// closes done once every entry queued before it has been written.
+type auditRequest struct {
+	entry models.AuditEntry
+	done  chan struct{}
+}
+
+func NewAuditLog() *AuditLog {
+	return newAuditLog(models.AuditEntry{}, nil)
+}
+
+func newAuditLog(head models.AuditEntry, file *rotatingFile) *AuditLog {
+	l := &AuditLog{
+		queue:   make(chan auditRequest, auditQueueSize),
+		stopped: make(chan struct{}),
+		head:    head,
+		file:    file,
+	}
+	go l.write()
+	return l
+}
+
+// OpenAuditLog continues the chain in the audit files still on disk and appends new
+// entries to path. The file is rotated once it would exceed maxBytes, keeping at most
+// maxFiles rotated files (path.1 being the most recent). Only the last entry is read.
+func OpenAuditLog(path string, maxBytes int64, maxFiles int) (*AuditLog, error) {
+	var head models.AuditEntry
+	for _, name := range auditFiles(path, maxFiles) {
+		line, err := lastLine(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &head); err != nil {
+			return nil, fmt.Errorf("invalid audit entry in %s: %v", name, err)
+		}
+		break
+	}
+
+	file, err := openRotatingFile(path, maxBytes, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return newAuditLog(head, file), nil
+}
+
+// Record queues an entry. before and after are snapshots of the affected state; nil
+// leaves them out. A failure to write the entry is logged by the writer.
+func (l *AuditLog) Record(tenant, action, couponID string, actor models.Actor, before, after interface{}) error {
+	entry := models.AuditEntry{
+		Tenant:    tenant,
+		Action:    action,
+		CouponID:  couponID,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+	var err error
+	if entry.Before, err = auditSnapshot(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditSnapshot(after); err != nil {
+		return err
+	}
+
+	l.closing.RLock()
+	defer l.closing.RUnlock()
+	if l.closed {
+		return errAuditLogClosed
+	}
+	l.queue <- auditRequest{entry: entry}
+	return nil
+}
+
+var errAuditLogClosed = errors.New("audit log is closed")
+
+// flush waits until every entry queued so far has been written.
+func (l *AuditLog) flush() {
+	l.closing.RLock()
+	defer l.closing.RUnlock()
+	if l.closed {
+		return
+	}
+	done := make(chan struct{})
+	l.queue <- auditRequest{done: done}
+	<-done
+}
+
+func (l *AuditLog) write() {
+	defer close(l.stopped)
+	for request := range l.queue {
+		if request.done != nil {
+			close(request.done)
+			continue
+		}
+		if err := l.append(request.entry); err != nil {
+			slog.Error("failed to record audit entry",
+				"request_id", request.entry.Actor.RequestID,
+				"tenant", request.entry.Tenant,
+				"action", request.entry.Action,
+				"coupon_id", request.entry.CouponID,
+				"error", err,
+			)
+		}
+		if len(l.queue) == 0 && l.file != nil {
+			if err := l.file.Sync(); err != nil {
+				slog.Error("failed to sync audit log", "error", err)
+			}
+		}
+	}
+}
+
+// append chains entry to the head and stores it.
+func (l *AuditLog) append(entry models.AuditEntry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.head.Sequence > 0 {
+		entry.Sequence = l.head.Sequence + 1
+		entry.PreviousHash = l.head.Hash
+	} else {
+		entry.Sequence = 1
+	}
+	var err error
+	if entry.Hash, err = auditHash(entry); err != nil {
+		return err
+	}
+
+	if l.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := l.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	} else {
+		l.entries = append(l.entries, entry)
+	}
+	l.head = entry
+	return nil
+}
+
+// Query returns the tenant's entries matching every filter set in query, newest first.
+func (l *AuditLog) Query(query models.AuditQuery) []models.AuditEntry {
+	l.flush()
+	entries, sections, err := l.view()
+	if err != nil {
+		slog.Error("failed to open audit log", "error", err)
+	}
+	defer closeAuditSections(sections)
+
+	matches := []models.AuditEntry{}
+	if l.file == nil {
+		for i := len(entries) - 1; i >= 0 && len(matches) < query.Limit; i-- {
+			if entry := entries[i]; auditEntryMatches(entry, query) {
+				matches = append(matches, entry)
+			}
+		}
+		return matches
+	}
+
+	for _, section := range sections {
+		var found []models.AuditEntry
+		err := readAuditSection(section, func(entry models.AuditEntry) error {
+			if auditEntryMatches(entry, query) {
+				found = append(found, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("failed to read audit log", "file", section.name, "error", err)
+		}
+		for i := len(found) - 1; i >= 0 && len(matches) < query.Limit; i-- {
+			matches = append(matches, found[i])
+		}
+		if len(matches) == query.Limit {
+			break
+		}
+	}
+	return matches
+}
+
+// Verify recomputes the hash chain and reports the first entry that does not match. The
+// oldest entry kept may follow one that was rotated away, so its link is not checked.
+func (l *AuditLog) Verify() error {
+	l.flush()
+	entries, sections, err := l.view()
+	if err != nil {
+		return err
+	}
+	defer closeAuditSections(sections)
+
+	var previous *models.AuditEntry
+	check := func(entry models.AuditEntry) error {
+		if previous != nil && entry.PreviousHash != previous.Hash {
+			return auditTampered(entry, "does not follow the previous entry")
+		}
+		hash, err := auditHash(entry)
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return auditTampered(entry, "does not match its hash")
+		}
+		previous = &entry
+		return nil
+	}
+
+	if l.file == nil {
+		for _, entry := range entries {
+			if err := check(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(sections) - 1; i >= 0; i-- {
+		if err := readAuditSection(sections[i], check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditSection is the part of an audit file written by the time it was opened. The open
+// file stays readable after the writer rotates or removes it.
+type auditSection struct {
+	name string
+	file *os.File
+	size int64
+}
+
+// view captures the entries written so far, so they can be read without holding up the
+// writer: the in-memory entries (which are only ever appended to), or the audit files,
+// newest first, opened and sized under the lock. The caller closes the sections.
+func (l *AuditLog) view() ([]models.AuditEntry, []auditSection, error) {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if l.file == nil {
+		return l.entries, nil, nil
+	}
+	var sections []auditSection
+	for _, name := range auditFiles(l.file.path, l.file.maxFiles) {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, sections, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, sections, err
+		}
+		sections = append(sections, auditSection{name: name, file: file, size: info.Size()})
+	}
+	return nil, sections, nil
+}
+
+func closeAuditSections(sections []auditSection) {
+	for _, section := range sections {
+		section.file.Close()
+	}
+}
+
+// Close writes the queued entries, then syncs and closes the file.
+func (l *AuditLog) Close() error {
+	l.closing.Lock()
+	if l.closed {
+		l.closing.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.closing.Unlock()
+	<-l.stopped
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// auditFiles names the current audit file and the rotated ones, newest first.
+func auditFiles(path string, maxFiles int) []string {
+	names := []string{path}
+	for i := 1; i <= maxFiles; i++ {
+		names = append(names, path+"."+strconv.Itoa(i))
+	}
+	return names
+}
+
+// readAuditSection calls visit for each entry in the section, oldest first.
+func readAuditSection(section auditSection, visit func(models.AuditEntry) error) error {
+	name := section.name
+	scanner := bufio.NewScanner(io.NewSectionReader(section.file, 0, section.size))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("invalid audit entry in %s: %v", name, err)
+		}
+		if err := visit(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// lastLine returns the last non-empty line of a file, reading backwards from the end. A
+// missing file has none.
+func lastLine(name string) ([]byte, error) {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		size := min(offset, 64*1024)
+		offset -= size
+		chunk := make([]byte, size)
+		if _, err := file.ReadAt(chunk, offset); err != nil {
+			return nil, err
+		}
+		tail = append(chunk, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		if start := bytes.LastIndexByte(trimmed, '\n'); start >= 0 {
+			return trimmed[start+1:], nil
+		}
+	}
+	return bytes.TrimRight(tail, "\n"), nil
+}
+
+// QueryAudit validates the query and returns the matching audit entries, newest first.
+func QueryAudit(query models.AuditQuery) ([]models.AuditEntry, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultAuditLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxAuditLimit {
+		return nil, invalidField("invalid_limit", "limit", fmt.Sprintf("limit must be between 1 and %d", MaxAuditLimit))
+	}
+	if query.Since != nil && query.Until != nil && query.Until.Before(*query.Since) {
+		return nil, invalidField("invalid_range", "until", "until must not be before since")
+	}
+	return Audit.Query(query), nil
+}
+
+func VerifyAudit() error {
+	return Audit.Verify()
+}
+
+// recordAudit appends to the audit trail. The action it records has already taken
+// effect, so a failure to persist the entry is logged rather than returned.
+func recordAudit(tenant, action, couponID string, actor models.Actor, before, after interface{}) {
+	if err := Audit.Record(tenant, action, couponID, actor, before, after); err != nil {
+		slog.Error("failed to record audit entry",
+			"request_id", actor.RequestID,
+			"tenant", tenant,
+			"action", action,
+			"coupon_id", couponID,
+			"error", err,
+		)
+	}
+}
+
+func auditEntryMatches(entry models.AuditEntry, query models.AuditQuery) bool {
+	if entry.Tenant != query.Tenant {
+		return false
+	}
+	if query.Action != "" && entry.Action != query.Action {
+		return false
+	}
+	if query.CouponID != "" && entry.CouponID != query.CouponID {
+		return false
+	}
+	if query.ActorID != "" && entry.Actor.ID != query.ActorID {
+		return false
+	}
+	if query.Since != nil && entry.CreatedAt.Before(*query.Since) {
+		return false
+	}
+	if query.Until != nil && !entry.CreatedAt.Before(*query.Until) {
+		return false
+	}
+	return true
+}
+
+func auditSnapshot(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+// auditHash is the SHA-256 of the entry's previous hash followed by its JSON encoding
+// with the hash itself left empty.
+func auditHash(entry models.AuditEntry) (string, error) {
+	entry.Hash = ""
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(entry.PreviousHash), content...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func auditTampered(entry models.AuditEntry, reason string) error {
+	return &Error{
+		Kind:    ErrConflict,
+		Code:    "audit_chain_broken",
+		Message: fmt.Sprintf("audit entry %d %s", entry.Sequence, reason),
+		Details: map[string]interface{}{"sequence": entry.Sequence},
+	}
+}
+
+// rotatingFile appends lines to a file, renaming it to path.1 (and older files to path.2
+// and so on) before a write would take it past maxBytes. Writes are not synced; the
+// caller syncs once a batch is written.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxBytes int64, maxFiles int) (*rotatingFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, maxBytes: maxBytes, maxFiles: maxFiles, file: file, size: info.Size()}, nil
+}
+
+func (f *rotatingFile) Write(line []byte) error {
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	written, err := f.file.Write(line)
+	f.size += int64(written)
+	return err
+}
+
+func (f *rotatingFile) Sync() error {
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxFiles > 0 {
+		for i := f.maxFiles - 1; i >= 1; i-- {
+			older := f.path + "." + strconv.Itoa(i)
+			if err := os.Rename(older, f.path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(f.path, f.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditTrail(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	Audit = NewAuditLog()
+
+	admin := models.Actor{ID: "admin", IP: "10.0.0.1", RequestID: "req-1"}
+	CreateCouponAs(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}, admin)
+	CreateCouponAs(models.Coupon{
+		ID:      "2",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 20.0, MaxUses: 5},
+	}, admin)
+
+	cart := models.Cart{Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 150.0}}}
+	if _, err := ApplyCouponAs(cart, "1", make(map[string]bool), models.Actor{ID: "shopper"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := DeleteCouponVersion(DefaultTenant, "2", AnyVersion, admin); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	entries, err := QueryAudit(models.AuditQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries, got %d", len(entries))
+	}
+	for i, action := range []string{"delete", "apply", "create", "create"} {
+		if entries[i].Action != action {
+			t.Fatalf("Expected entry %d to be %s, got %s", i, action, entries[i].Action)
+		}
+	}
+	if entries[3].Before != nil || entries[3].After == nil || entries[0].After != nil {
+		t.Fatalf("Expected create to have only an after state and delete only a before state")
+	}
+	if entries[3].Actor != admin || entries[0].PreviousHash != entries[1].Hash {
+		t.Fatalf("Expected actor and hash chain to be recorded, got %+v", entries[3])
+	}
+
+	admins, _ := QueryAudit(models.AuditQuery{ActorID: "admin"})
+	applies, _ := QueryAudit(models.AuditQuery{Action: "apply", CouponID: "1"})
+	if len(admins) != 3 || len(applies) != 1 {
+		t.Fatalf("Expected filters to match 3 and 1 entries, got %d and %d", len(admins), len(applies))
+	}
+	if _, err := QueryAudit(models.AuditQuery{Limit: MaxAuditLimit + 1}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected limit to be rejected, got %v", err)
+	}
+
+	if err := VerifyAudit(); err != nil {
+		t.Fatalf("Expected intact chain, got %v", err)
+	}
+	Audit.entries[1].Actor.ID = "someone-else"
+	if err := VerifyAudit(); err == nil {
+		t.Fatalf("Expected tampering to be detected")
+	}
+}
+
+func TestAuditLogFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	auditLog, err := OpenAuditLog(path, 600, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		if err := auditLog.Record(DefaultTenant, "apply", "1", models.Actor{ID: "shopper"}, nil, map[string]int{"uses": i}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	auditLog.Close()
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("Expected audit file to be rotated, got %v", err)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Expected at most 2 rotated files, got %v", err)
+	}
+
+	reopened, err := OpenAuditLog(path, 600, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer reopened.Close()
+	if err := reopened.Verify(); err != nil {
+		t.Fatalf("Expected replayed chain to verify, got %v", err)
+	}
+	if err := reopened.Record(DefaultTenant, "apply", "1", models.Actor{}, nil, nil); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entries := reopened.Query(models.AuditQuery{Limit: 1})
+	if len(entries) != 1 || entries[0].Sequence != 7 {
+		t.Fatalf("Expected sequence to continue at 7, got %+v", entries)
+	}
+
+	// Queries read the rotated files too, newest first.
+	entries = reopened.Query(models.AuditQuery{Limit: MaxAuditLimit})
+	if len(entries) < 4 {
+		t.Fatalf("Expected entries from the rotated files, got %d", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Sequence != entries[i-1].Sequence-1 {
+			t.Fatalf("Expected consecutive entries newest first, got %d after %d", entries[i].Sequence, entries[i-1].Sequence)
+		}
+	}
+
+	content, _ := os.ReadFile(path + ".1")
+	os.WriteFile(path+".1", []byte(strings.Replace(string(content), `"shopper"`, `"someone"`, 1)), 0o644)
+	if err := reopened.Verify(); err == nil {
+		t.Fatalf("Expected tampering with the file to be detected")
+	}
+}
+
+func TestAuditLogQueriesWhileRotating(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := OpenAuditLog(path, 600, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer auditLog.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			auditLog.Record(DefaultTenant, "apply", "1", models.Actor{ID: "shopper"}, nil, map[string]int{"uses": i})
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		if err := auditLog.Verify(); err != nil {
+			t.Fatalf("Expected the files to verify while being rotated, got %v", err)
+		}
+		entries := auditLog.Query(models.AuditQuery{Limit: MaxAuditLimit})
+		for i := 1; i < len(entries); i++ {
+			if entries[i].Sequence != entries[i-1].Sequence-1 {
+				t.Fatalf("Expected consecutive entries newest first, got %d after %d", entries[i].Sequence, entries[i-1].Sequence)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"strings"
+)
+
+const MaxCartLines = 500
+
+// ValidateCart rejects malformed cart lines, reporting every violation at once. Duplicate
+// product lines are rejected unless normalize is set, in which case lines with the same
+// product and price are merged and the merge is reported back. A cart without a currency
+// is priced in its tenant's currency; coupons hold amounts in that currency, so any other
+// currency is rejected.
+func ValidateCart(cart models.Cart, normalize bool) (models.Cart, *models.CartNormalization, error) {
+	var found violations
+
+	if len(cart.Items) == 0 {
+		return cart, nil, ErrCartEmpty
+	}
+	tenant, err := ResolveTenant(cart.TenantID)
+	if err != nil {
+		return cart, nil, err
+	}
+	if cart.Currency = strings.ToUpper(cart.Currency); cart.Currency == "" {
+		cart.Currency = tenant.Currency
+	} else if cart.Currency != tenant.Currency {
+		found.add("cart.currency", "currency_mismatch", fmt.Sprintf("cart currency must be %s", tenant.Currency))
+	}
+	if hasControlCharacters(cart.CustomerID) {
+		found.add("cart.customer_id", "invalid_customer_id", "customer ID cannot contain control characters")
+	}
+	if cart.Customer != nil && hasControlCharacters(cart.Customer.ID) {
+		found.add("cart.customer.id", "invalid_customer_id", "customer ID cannot contain control characters")
+	}
+	if len(cart.Items) > MaxCartLines {
+		found.add("cart.items", "too_many_lines", fmt.Sprintf("cart cannot have more than %d lines", MaxCartLines))
+		return cart, nil, found.err()
+	}
+
+	firstLine := make(map[string]int)
+	for i, item := range cart.Items {
+		field := fmt.Sprintf("cart.items[%d]", i)
+		if item.ProductID == "" {
+			found.add(field+".product_id", "product_id_required", "product ID is required")
+		}
+		if item.Quantity <= 0 {
+			found.add(field+".quantity", "invalid_quantity", "quantity must be positive")
+		}
+		if item.Price < 0 {
+			found.add(field+".price", "invalid_price", "price cannot be negative")
+		}
+		if item.TotalDiscount < 0 {
+			found.add(field+".total_discount", "invalid_total_discount", "total discount cannot be negative")
+		}
+
+		first, duplicate := firstLine[item.ProductID]
+		switch {
+		case item.ProductID == "" || !duplicate:
+			firstLine[item.ProductID] = i
+		case !normalize:
+			found.add(field+".product_id", "duplicate_product", fmt.Sprintf("product %s appears on more than one line", item.ProductID))
+		case cart.Items[first].Price != item.Price:
+			found.add(field+".price", "conflicting_price", fmt.Sprintf("product %s has different prices on different lines", item.ProductID))
+		}
+	}
+	if err := found.err(); err != nil {
+		return cart, nil, err
+	}
+	if !normalize {
+		return cart, nil, nil
+	}
+	return normalizeCart(cart)
+}
+
+func normalizeCart(cart models.Cart) (models.Cart, *models.CartNormalization, error) {
+	normalization := &models.CartNormalization{LinesBefore: len(cart.Items), MergedProducts: []string{}}
+	merged := make([]models.CartItem, 0, len(cart.Items))
+	lineFor := make(map[string]int)
+	reported := make(map[string]bool)
+
+	for _, item := range cart.Items {
+		line, exists := lineFor[item.ProductID]
+		if !exists {
+			lineFor[item.ProductID] = len(merged)
+			merged = append(merged, item)
+			continue
+		}
+
+		merged[line].Quantity += item.Quantity
+		merged[line].TotalDiscount += item.TotalDiscount
+		if !reported[item.ProductID] {
+			reported[item.ProductID] = true
+			normalization.MergedProducts = append(normalization.MergedProducts, item.ProductID)
+		}
+	}
+
+	cart.Items = merged
+	normalization.LinesAfter = len(merged)
+	return cart, normalization, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+)
+
+func TestValidateCart(t *testing.T) {
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: -1, Price: 100.0},
+			{ProductID: "B456", Quantity: 1, Price: -5.0},
+		},
+	}
+
+	_, _, err := ValidateCart(cart, false)
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || serviceErr.Code != "validation_failed" {
+		t.Fatalf("Expected validation_failed, got %v", err)
+	}
+	if violations := serviceErr.Details["violations"].([]Violation); len(violations) != 2 {
+		t.Fatalf("Expected 2 violations, got %+v", violations)
+	}
+
+	tooLong := models.Cart{Items: make([]models.CartItem, MaxCartLines+1)}
+	if _, _, err := ValidateCart(tooLong, false); err == nil || err.Error() != "cart cannot have more than 500 lines" {
+		t.Fatalf("Expected line cap error, got %v", err)
+	}
+}
+
+func TestValidateCart_Normalization(t *testing.T) {
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+			{ProductID: "B456", Quantity: 1, Price: 50.0},
+			{ProductID: "A123", Quantity: 2, Price: 100.0},
+		},
+	}
+
+	if _, _, err := ValidateCart(cart, false); err == nil || err.Error() != "product A123 appears on more than one line" {
+		t.Fatalf("Expected duplicate line error, got %v", err)
+	}
+
+	normalized, normalization, err := ValidateCart(cart, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(normalized.Items) != 2 || normalized.Items[0].Quantity != 3 {
+		t.Fatalf("Expected A123 lines to merge into quantity 3, got %+v", normalized.Items)
+	}
+	if normalization.LinesBefore != 3 || normalization.LinesAfter != 2 || len(normalization.MergedProducts) != 1 {
+		t.Fatalf("Unexpected normalization report %+v", normalization)
+	}
+
+	cart.Items[2].Price = 90.0
+	if _, _, err := ValidateCart(cart, true); err == nil || err.Error() != "product A123 has different prices on different lines" {
+		t.Fatalf("Expected conflicting price error, got %v", err)
+	}
+}
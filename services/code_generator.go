@@ -0,0 +1,207 @@
+package services
+
+import (
+	"coupon/models"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const (
+	defaultCodeAlphabet    = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	defaultCodePattern     = "########"
+	ambiguousCodeChars     = "0O1IL"
+	codePlaceholder        = '#'
+	maxCodeBatchSize       = 1000000
+	maxCodeAttemptsPerCode = 100
+)
+
+// GeneratedCodes holds single-use (or limited-use) codes that all redeem a parent coupon,
+// keyed by tenant-scoped code.
+var GeneratedCodes = make(map[string]models.GeneratedCode)
+
+// GenerateCodes creates request.Count unique random codes for the given coupon and hands
+// each one to emit as soon as it is registered, so callers can stream large batches.
+// From the first code on, the coupon is codes-only: it can no longer be redeemed by ID or
+// by its own code and aliases, only through generated codes, each of which still counts
+// against the coupon's max_uses.
+func GenerateCodes(tenant, couponID string, request models.CodeBatchRequest, emit func(models.GeneratedCode) error) error {
+	couponsMutex.RLock()
+	_, exists := Coupons[tenantKey(tenant, couponID)]
+	couponsMutex.RUnlock()
+	if !exists {
+		return ErrCouponNotFound
+	}
+
+	alphabet, pattern, err := validateCodeBatchRequest(&request)
+	if err != nil {
+		return err
+	}
+
+	for generated := 0; generated < request.Count; generated++ {
+		// The lock is held per code rather than per batch so redemptions are not blocked
+		// while a large batch is streamed to a slow client.
+		couponsMutex.Lock()
+		code, err := newUniqueCode(tenant, request.Prefix, pattern, alphabet, request.CheckDigit)
+		if err != nil {
+			couponsMutex.Unlock()
+			return err
+		}
+
+		generatedCode := models.GeneratedCode{
+			Code:     code,
+			TenantID: tenant,
+			CouponID: couponID,
+			MaxUses:  request.MaxUses,
+		}
+		GeneratedCodes[tenantKey(tenant, code)] = generatedCode
+		markCodesOnly(tenant, couponID)
+		couponStoreChanged()
+		couponsMutex.Unlock()
+
+		if err := emit(generatedCode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markCodesOnly flags the coupon as redeemable only through its generated codes. The
+// caller holds couponsMutex.
+func markCodesOnly(tenant, couponID string) {
+	key := tenantKey(tenant, couponID)
+	if coupon, exists := Coupons[key]; exists && !coupon.CodesOnly {
+		coupon.CodesOnly = true
+		Coupons[key] = coupon
+	}
+}
+
+func validateCodeBatchRequest(request *models.CodeBatchRequest) (string, string, error) {
+	if request.Count <= 0 || request.Count > maxCodeBatchSize {
+		return "", "", invalidField("invalid_count", "count", fmt.Sprintf("invalid count: must be between 1 and %d", maxCodeBatchSize))
+	}
+	if request.MaxUses < 0 {
+		return "", "", invalidField("invalid_max_uses", "max_uses", "invalid max uses: must be positive")
+	}
+	if request.MaxUses == 0 {
+		request.MaxUses = 1
+	}
+
+	alphabet := defaultCodeAlphabet
+	if request.Alphabet != "" {
+		alphabet = uniqueChars(strings.ToUpper(request.Alphabet))
+	}
+	if strings.ContainsAny(alphabet, ambiguousCodeChars) {
+		return "", "", invalidField("invalid_alphabet", "alphabet", fmt.Sprintf("invalid alphabet: must not contain ambiguous characters %q", ambiguousCodeChars))
+	}
+	if len(alphabet) < 2 || strings.ContainsAny(alphabet, " \t\n#") {
+		return "", "", invalidField("invalid_alphabet", "alphabet", "invalid alphabet: needs at least two printable characters")
+	}
+	// Codes are built and check-summed byte by byte, so only printable ASCII is allowed.
+	for i := 0; i < len(alphabet); i++ {
+		if alphabet[i] < '!' || alphabet[i] > '~' {
+			return "", "", invalidField("invalid_alphabet", "alphabet", "invalid alphabet: must contain only printable ASCII characters")
+		}
+	}
+
+	pattern := defaultCodePattern
+	if request.Pattern != "" {
+		pattern = strings.ToUpper(request.Pattern)
+	}
+	slots := strings.Count(pattern, string(codePlaceholder))
+	if slots == 0 {
+		return "", "", invalidField("invalid_pattern", "pattern", "invalid pattern: must contain at least one '#' placeholder")
+	}
+	if NormalizeCode(request.Prefix+pattern) != strings.ToUpper(request.Prefix+pattern) || hasControlCharacters(request.Prefix+pattern) {
+		return "", "", invalidField("invalid_pattern", "pattern", "invalid pattern: must not contain whitespace or control characters")
+	}
+	request.Prefix = strings.ToUpper(request.Prefix)
+
+	// Keep the batch well inside the keyspace so retries on collision stay cheap.
+	if math.Pow(float64(len(alphabet)), float64(slots)) < float64(request.Count)*10 {
+		return "", "", invalidField("invalid_pattern", "pattern", "invalid pattern: not enough combinations for the requested count")
+	}
+	return alphabet, pattern, nil
+}
+
+func newUniqueCode(tenant, prefix, pattern, alphabet string, checkDigit bool) (string, error) {
+	for attempt := 0; attempt < maxCodeAttemptsPerCode; attempt++ {
+		code, err := randomCode(prefix, pattern, alphabet)
+		if err != nil {
+			return "", err
+		}
+		if checkDigit {
+			code += string(checkCharacter(code, alphabet))
+		}
+		if !codeInUse(tenant, code) {
+			return code, nil
+		}
+	}
+	return "", ErrCodeKeyspaceExhausted
+}
+
+func randomCode(prefix, pattern, alphabet string) (string, error) {
+	var builder strings.Builder
+	builder.WriteString(prefix)
+	alphabetSize := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != codePlaceholder {
+			builder.WriteByte(pattern[i])
+			continue
+		}
+		index, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(alphabet[index.Int64()])
+	}
+	return builder.String(), nil
+}
+
+func codeInUse(tenant, code string) bool {
+	if _, exists := CouponCodes[tenantKey(tenant, code)]; exists {
+		return true
+	}
+	_, exists := GeneratedCodes[tenantKey(tenant, code)]
+	return exists
+}
+
+// checkCharacter computes a Luhn mod N check character over the characters of code that
+// belong to alphabet; prefix and separator characters are ignored.
+func checkCharacter(code, alphabet string) byte {
+	n := len(alphabet)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		codePoint := strings.IndexByte(alphabet, code[i])
+		if codePoint < 0 {
+			continue
+		}
+		addend := factor * codePoint
+		factor = 3 - factor
+		sum += addend/n + addend%n
+	}
+	return alphabet[(n-sum%n)%n]
+}
+
+// ValidCheckCharacter reports whether the last character of code is a valid check character.
+func ValidCheckCharacter(code, alphabet string) bool {
+	if len(code) < 2 {
+		return false
+	}
+	return checkCharacter(code[:len(code)-1], alphabet) == code[len(code)-1]
+}
+
+func uniqueChars(s string) string {
+	var builder strings.Builder
+	seen := make(map[rune]bool)
+	for _, r := range s {
+		if !seen[r] {
+			seen[r] = true
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
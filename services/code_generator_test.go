@@ -0,0 +1,187 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCodes(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 1000},
+	}
+	CreateCoupon(coupon)
+
+	request := models.CodeBatchRequest{
+		Count:      500,
+		Prefix:     "spring-",
+		Pattern:    "####-####",
+		CheckDigit: true,
+	}
+
+	codes := make(map[string]bool)
+	err := GenerateCodes(DefaultTenant, "1", request, func(code models.GeneratedCode) error {
+		if codes[code.Code] {
+			t.Fatalf("Duplicate code generated: %s", code.Code)
+		}
+		codes[code.Code] = true
+		if !strings.HasPrefix(code.Code, "SPRING-") || len(code.Code) != len("SPRING-####-####")+1 {
+			t.Fatalf("Unexpected code format: %s", code.Code)
+		}
+		if !ValidCheckCharacter(code.Code, defaultCodeAlphabet) {
+			t.Fatalf("Invalid check character in %s", code.Code)
+		}
+		if code.MaxUses != 1 {
+			t.Fatalf("Expected max uses 1, got %d", code.MaxUses)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(codes) != 500 || len(GeneratedCodes) != 500 {
+		t.Fatalf("Expected 500 codes, got %d", len(codes))
+	}
+}
+
+func TestGenerateCodes_InvalidRequest(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+
+	Coupons["1"] = models.Coupon{ID: "1", Type: "cart-wise"}
+	emit := func(models.GeneratedCode) error { return nil }
+
+	err := GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 10, Alphabet: "ABC0"}, emit)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid alphabet") {
+		t.Fatalf("Expected invalid alphabet error, got %v", err)
+	}
+
+	err = GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 10, Alphabet: "ÄÖÜß"}, emit)
+	if err == nil || err.Error() != "invalid alphabet: must contain only printable ASCII characters" {
+		t.Fatalf("Expected non-ASCII alphabet error, got %v", err)
+	}
+
+	err = GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 1000, Pattern: "##"}, emit)
+	if err == nil || err.Error() != "invalid pattern: not enough combinations for the requested count" {
+		t.Fatalf("Expected keyspace error, got %v", err)
+	}
+
+	err = GenerateCodes(DefaultTenant, "2", models.CodeBatchRequest{Count: 1}, emit)
+	if err == nil || err.Error() != "coupon not found" {
+		t.Fatalf("Expected 'coupon not found' error, got %v", err)
+	}
+}
+
+func TestApplyCouponByCode_SingleUse(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 10},
+	}
+	CreateCoupon(coupon)
+
+	var code string
+	GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 1}, func(generated models.GeneratedCode) error {
+		code = generated.Code
+		return nil
+	})
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+	}
+
+	if _, err := ApplyCouponByCode(cart, strings.ToLower(code), make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err := ApplyCouponByCode(cart, code, make(map[string]bool))
+	if err == nil || err.Error() != "coupon code has already been redeemed" {
+		t.Fatalf("Expected 'coupon code has already been redeemed' error, got %v", err)
+	}
+}
+
+func TestApplyCouponByCode_ParentMaxUsesCapsBatch(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 2},
+	})
+
+	var codes []string
+	GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 3}, func(generated models.GeneratedCode) error {
+		codes = append(codes, generated.Code)
+		return nil
+	})
+
+	cart := models.Cart{Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 100.0}}}
+	for _, code := range codes[:2] {
+		if _, err := ApplyCouponByCode(cart, code, make(map[string]bool)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	_, err := ApplyCouponByCode(cart, codes[2], make(map[string]bool))
+	if !errors.Is(err, ErrUsageLimitExceeded) {
+		t.Fatalf("Expected the coupon's max_uses to cap the batch, got %v", err)
+	}
+	if uses := GeneratedCodes[codes[2]].Uses; uses != 0 {
+		t.Fatalf("Expected the unredeemed code to keep its use, got %d uses", uses)
+	}
+}
+
+func TestApplyCoupon_CodesOnlyAfterGeneration(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Code:    "SPRING",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 10},
+	})
+
+	var code string
+	GenerateCodes(DefaultTenant, "1", models.CodeBatchRequest{Count: 1}, func(generated models.GeneratedCode) error {
+		code = generated.Code
+		return nil
+	})
+	if !Coupons["1"].CodesOnly {
+		t.Fatalf("Expected the coupon to be codes-only after generating codes")
+	}
+
+	cart := models.Cart{Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 100.0}}}
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); !errors.Is(err, ErrGeneratedCodeRequired) {
+		t.Fatalf("Expected apply by ID to be rejected, got %v", err)
+	}
+	if _, err := ApplyCouponByCode(cart, "spring", make(map[string]bool)); !errors.Is(err, ErrGeneratedCodeRequired) {
+		t.Fatalf("Expected the coupon's own code to be rejected, got %v", err)
+	}
+	if _, err := ApplyCouponByCode(cart, code, make(map[string]bool)); err != nil {
+		t.Fatalf("Expected the generated code to apply, got %v", err)
+	}
+
+	if err := UpdateCoupon("1", models.Coupon{Type: "cart-wise", Code: "SPRING", Details: models.CouponDetails{Threshold: 100.0, Discount: 15.0, MaxUses: 10}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !Coupons["1"].CodesOnly {
+		t.Fatalf("Expected a replacement to keep the coupon codes-only")
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"strings"
+)
+
+// CouponCodes maps a tenant-scoped normalized shopper-facing code to the ID of the coupon
+// it redeems. Each tenant has its own code namespace.
+var CouponCodes = make(map[string]string)
+
+// NormalizeCode makes code lookups case-insensitive and tolerant of stray whitespace.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(code), ""))
+}
+
+func couponCodes(coupon models.Coupon) []string {
+	codes := make([]string, 0, len(coupon.Aliases)+1)
+	for _, code := range append([]string{coupon.Code}, coupon.Aliases...) {
+		if normalized := NormalizeCode(code); normalized != "" {
+			codes = append(codes, normalized)
+		}
+	}
+	return codes
+}
+
+func checkCodes(coupon models.Coupon) error {
+	seen := make(map[string]bool)
+	for _, code := range couponCodes(coupon) {
+		if seen[code] {
+			return &Error{Kind: ErrInvalid, Code: "duplicate_code", Field: "aliases", Message: fmt.Sprintf("duplicate coupon code: %s", code)}
+		}
+		seen[code] = true
+		key := tenantKey(coupon.TenantID, code)
+		if owner, exists := CouponCodes[key]; exists && owner != coupon.ID {
+			return &Error{Kind: ErrConflict, Code: "code_in_use", Field: "code", Message: fmt.Sprintf("coupon code already in use: %s", code)}
+		}
+		if _, exists := GeneratedCodes[key]; exists {
+			return &Error{Kind: ErrConflict, Code: "code_in_use", Field: "code", Message: fmt.Sprintf("coupon code already in use: %s", code)}
+		}
+	}
+	return nil
+}
+
+func registerCodes(coupon models.Coupon) {
+	for _, code := range couponCodes(coupon) {
+		CouponCodes[tenantKey(coupon.TenantID, code)] = coupon.ID
+	}
+}
+
+func unregisterCodes(coupon models.Coupon) {
+	for _, code := range couponCodes(coupon) {
+		key := tenantKey(coupon.TenantID, code)
+		if CouponCodes[key] == coupon.ID {
+			delete(CouponCodes, key)
+		}
+	}
+}
+
+func unregisterGeneratedCodes(coupon models.Coupon) {
+	for key, generated := range GeneratedCodes {
+		if generated.TenantID == coupon.TenantID && generated.CouponID == coupon.ID {
+			delete(GeneratedCodes, key)
+		}
+	}
+}
+
+func GetCouponByCode(tenant, code string) (models.Coupon, error) {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	return getCouponByCode(tenant, code)
+}
+
+func getCouponByCode(tenant, code string) (models.Coupon, error) {
+	key := tenantKey(tenant, NormalizeCode(code))
+	if generated, exists := GeneratedCodes[key]; exists {
+		return getCouponByID(tenant, generated.CouponID)
+	}
+	couponID, exists := CouponCodes[key]
+	if !exists {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+	return getCouponByID(tenant, couponID)
+}
+
+func ApplyCouponByCode(cart models.Cart, code string, appliedCoupons map[string]bool) (models.Cart, error) {
+	return ApplyCouponByCodeAs(cart, code, appliedCoupons, models.Actor{})
+}
+
+// ApplyCouponByCodeAs applies the coupon a code belongs to and records the actor in the
+// audit trail.
+func ApplyCouponByCodeAs(cart models.Cart, code string, appliedCoupons map[string]bool, actor models.Actor) (models.Cart, error) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	coupon, _ := getCouponByCode(cart.TenantID, code)
+	updatedCart, err := applyCouponByCode(cart, code, appliedCoupons, actor)
+	observeApply(coupon.Type, cart, updatedCart, err)
+	return updatedCart, err
+}
+
+func applyCouponByCode(cart models.Cart, code string, appliedCoupons map[string]bool, actor models.Actor) (models.Cart, error) {
+	key := tenantKey(cart.TenantID, NormalizeCode(code))
+	generated, isGenerated := GeneratedCodes[key]
+	if isGenerated && generated.Uses >= generated.MaxUses {
+		return cart, ErrCodeRedeemed
+	}
+
+	coupon, err := getCouponByCode(cart.TenantID, code)
+	if err != nil {
+		return cart, err
+	}
+
+	updatedCart, err := applyCoupon(cart, coupon.ID, NormalizeCode(code), appliedCoupons, actor)
+	if err != nil {
+		return cart, err
+	}
+
+	if isGenerated {
+		generated.Uses++
+		GeneratedCodes[key] = generated
+	}
+	return updatedCart, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"coupon/models"
+	"testing"
+)
+
+func TestCreateCoupon_CodeUniqueness(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	coupon1 := models.Coupon{
+		ID:      "1",
+		Code:    "SAVE10",
+		Aliases: []string{"WELCOME10"},
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}
+	if err := CreateCoupon(coupon1); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	coupon2 := models.Coupon{
+		ID:      "2",
+		Code:    " welcome 10 ",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 20.0, MaxUses: 5},
+	}
+	err := CreateCoupon(coupon2)
+	if err == nil || err.Error() != "coupon code already in use: WELCOME10" {
+		t.Fatalf("Expected 'coupon code already in use: WELCOME10', got %v", err)
+	}
+	if _, exists := Coupons["2"]; exists {
+		t.Fatalf("Expected coupon 2 not to be stored")
+	}
+}
+
+func TestApplyCouponByCode(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Code:    "SAVE10",
+		Aliases: []string{"WELCOME10"},
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}
+	CreateCoupon(coupon)
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 2, Price: 100.0},
+		},
+	}
+
+	updatedCart, err := ApplyCouponByCode(cart, " save10 ", make(map[string]bool))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updatedCart.TotalDiscount != 20.0 {
+		t.Fatalf("Expected discount 20.0, got %f", updatedCart.TotalDiscount)
+	}
+
+	if _, err := ApplyCouponByCode(cart, "welcome10", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected alias to apply, got %v", err)
+	}
+
+	if _, err := ApplyCouponByCode(cart, "UNKNOWN", make(map[string]bool)); err == nil || err.Error() != "coupon not found" {
+		t.Fatalf("Expected 'coupon not found' error, got %v", err)
+	}
+
+	CreateCoupon(models.Coupon{
+		ID:      "2",
+		Code:    "SPRING",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+	DeleteCoupon("2")
+	if _, err := GetCouponByCode(DefaultTenant, "SPRING"); err == nil {
+		t.Fatalf("Expected code to be released after delete")
+	}
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"bytes"
+	"coupon/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSV list cells separate values with listSeparator; product cells hold
+// "product_id:quantity" pairs.
+const listSeparator = ";"
+
+// CouponRow is one row of an import. Err is set when the row could not be read into a
+// coupon.
+type CouponRow struct {
+	Coupon models.Coupon
+	Err    error
+}
+
+// couponColumn maps one CSV column to a coupon field. Read-only columns, which the
+// service maintains, have no set function and are ignored on import.
+type couponColumn struct {
+	name string
+	get  func(models.Coupon) string
+	set  func(coupon *models.Coupon, value string, location *time.Location) error
+}
+
+var couponColumns = []couponColumn{
+	stringColumn("id", func(c *models.Coupon) *string { return &c.ID }),
+	stringColumn("type", func(c *models.Coupon) *string { return &c.Type }),
+	stringColumn("status", func(c *models.Coupon) *string { return &c.Status }),
+	stringColumn("code", func(c *models.Coupon) *string { return &c.Code }),
+	listColumn("aliases", func(c *models.Coupon) *[]string { return &c.Aliases }),
+	floatColumn("threshold", func(c *models.Coupon) *float64 { return &c.Details.Threshold }),
+	floatColumn("discount", func(c *models.Coupon) *float64 { return &c.Details.Discount }),
+	stringColumn("product_id", func(c *models.Coupon) *string { return &c.Details.ProductID }),
+	{
+		name: "buy_products",
+		get: func(c models.Coupon) string {
+			pairs := make([]string, len(c.Details.BuyProducts))
+			for i, product := range c.Details.BuyProducts {
+				pairs[i] = product.ProductID + ":" + strconv.Itoa(product.Quantity)
+			}
+			return strings.Join(pairs, listSeparator)
+		},
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			products, err := parseProducts("buy_products", value)
+			c.Details.BuyProducts = nil
+			for _, product := range products {
+				c.Details.BuyProducts = append(c.Details.BuyProducts, models.BuyProduct(product))
+			}
+			return err
+		},
+	},
+	{
+		name: "get_products",
+		get: func(c models.Coupon) string {
+			pairs := make([]string, len(c.Details.GetProducts))
+			for i, product := range c.Details.GetProducts {
+				pairs[i] = product.ProductID + ":" + strconv.Itoa(product.Quantity)
+			}
+			return strings.Join(pairs, listSeparator)
+		},
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			products, err := parseProducts("get_products", value)
+			c.Details.GetProducts = nil
+			for _, product := range products {
+				c.Details.GetProducts = append(c.Details.GetProducts, models.GetProduct(product))
+			}
+			return err
+		},
+	},
+	intColumn("repetition_limit", func(c *models.Coupon) *int { return &c.Details.RepetitionLimit }),
+	timeColumn("start_date", func(c *models.Coupon) **time.Time { return &c.Details.StartDate }),
+	timeColumn("expiry_date", func(c *models.Coupon) **time.Time { return &c.Details.ExpiryDate }),
+	intColumn("max_uses", func(c *models.Coupon) *int { return &c.Details.MaxUses }),
+	readOnlyColumn("uses", func(c models.Coupon) string { return strconv.Itoa(c.Details.Uses) }),
+	intColumn("max_uses_per_customer", func(c *models.Coupon) *int { return &c.Details.MaxUsesPerCustomer }),
+	boolColumn("exclusive", func(c *models.Coupon) *bool { return &c.Details.Exclusive }),
+	floatColumn("min_cart_value", func(c *models.Coupon) *float64 { return &c.Details.MinCartValue }),
+	listColumn("excluded_products", func(c *models.Coupon) *[]string { return &c.Details.ExcludedProducts }),
+	listColumn("customer_ids", func(c *models.Coupon) *[]string { return &c.Details.CustomerIDs }),
+	listColumn("customer_tiers", func(c *models.Coupon) *[]string { return &c.Details.CustomerTiers }),
+	listColumn("customer_tags", func(c *models.Coupon) *[]string { return &c.Details.CustomerTags }),
+	boolColumn("new_customers_only", func(c *models.Coupon) *bool { return &c.Details.NewCustomersOnly }),
+	intColumn("max_account_age_days", func(c *models.Coupon) *int { return &c.Details.MaxAccountAgeDays }),
+	boolColumn("first_order_only", func(c *models.Coupon) *bool { return &c.Details.FirstOrderOnly }),
+	intColumn("min_days_since_last_order", func(c *models.Coupon) *int { return &c.Details.MinDaysSinceLastOrder }),
+	readOnlyColumn("version", func(c models.Coupon) string { return strconv.Itoa(c.Version) }),
+	readOnlyColumn("created_at", func(c models.Coupon) string { return c.CreatedAt.UTC().Format(time.RFC3339) }),
+	readOnlyColumn("updated_at", func(c models.Coupon) string { return c.UpdatedAt.UTC().Format(time.RFC3339) }),
+}
+
+// CouponCSVHeader is the header row of a CSV export.
+func CouponCSVHeader() []string {
+	header := make([]string, len(couponColumns))
+	for i, column := range couponColumns {
+		header[i] = column.name
+	}
+	return header
+}
+
+// CouponCSVRecord is a coupon as a CSV export row.
+func CouponCSVRecord(coupon models.Coupon) []string {
+	record := make([]string, len(couponColumns))
+	for i, column := range couponColumns {
+		record[i] = column.get(coupon)
+	}
+	return record
+}
+
+// ReadCouponsCSV reads an import file with a header row naming any of the export
+// columns, in any order. Dates without a time are midnight in location. A file that is not
+// valid CSV or has an unknown column is rejected whole; a row with a bad cell gets an
+// error of its own.
+func ReadCouponsCSV(r io.Reader, location *time.Location) ([]CouponRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]couponColumn, len(header))
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		column, ok := findCouponColumn(name)
+		if !ok {
+			return nil, invalidField("unknown_column", name, fmt.Sprintf("unknown column: %s", name))
+		}
+		if seen[name] {
+			return nil, invalidField("duplicate_column", name, fmt.Sprintf("duplicate column: %s", name))
+		}
+		seen[name] = true
+		columns[i] = column
+	}
+
+	var rows []CouponRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var row CouponRow
+		if len(record) != len(columns) {
+			row.Err = newError(ErrInvalid, "invalid_row", fmt.Sprintf("row has %d cells, header has %d", len(record), len(columns)))
+		}
+		for i := 0; i < len(record) && row.Err == nil; i++ {
+			if columns[i].set != nil {
+				row.Err = columns[i].set(&row.Coupon, strings.TrimSpace(record[i]), location)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// ReadCouponsJSON reads an import file holding a JSON array of coupons in the format
+// POST /coupons accepts. An element with unknown fields or wrong types fails on its own.
+func ReadCouponsJSON(r io.Reader) ([]CouponRow, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elements); err != nil {
+		return nil, err
+	}
+
+	rows := make([]CouponRow, len(elements))
+	for i, element := range elements {
+		decoder := json.NewDecoder(bytes.NewReader(element))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rows[i].Coupon); err != nil {
+			rows[i].Err = newError(ErrInvalid, "invalid_row", err.Error())
+		}
+	}
+	return rows, nil
+}
+
+// ImportCoupons validates every row as POST /coupons would, after importedCoupon has
+// dropped the fields the service maintains, and also rejects IDs and codes claimed by an
+// earlier row. It then creates the coupons unless dryRun is set. In all_or_nothing mode a
+// single invalid row rejects the import and the per-row results are returned in the
+// error's details.
+func ImportCoupons(tenant string, rows []CouponRow, mode string, dryRun bool, actor models.Actor) (models.CouponImportResult, error) {
+	if mode == "" {
+		mode = models.ImportAllOrNothing
+	}
+	if mode != models.ImportAllOrNothing && mode != models.ImportBestEffort {
+		return models.CouponImportResult{}, invalidField("invalid_mode", "mode", "mode must be all_or_nothing or best_effort")
+	}
+	if len(rows) == 0 {
+		return models.CouponImportResult{}, newError(ErrInvalid, "import_empty", "import contains no coupons")
+	}
+
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	result := models.CouponImportResult{Mode: mode, DryRun: dryRun, Total: len(rows), Rows: make([]models.CouponImportRow, len(rows))}
+	claimedIDs := make(map[string]bool)
+	claimedCodes := make(map[string]bool)
+	for i, row := range rows {
+		row.Coupon = importedCoupon(row.Coupon, tenant)
+		rows[i] = row
+		err := row.Err
+		if err == nil {
+			err = checkImportedCoupon(row.Coupon, claimedIDs, claimedCodes)
+		}
+
+		result.Rows[i] = models.CouponImportRow{Row: i + 1, ID: row.Coupon.ID, Status: models.ImportRowValid}
+		if err != nil {
+			result.Rows[i].Status = models.ImportRowInvalid
+			result.Rows[i].Error = importError(err)
+			result.Invalid++
+			continue
+		}
+		result.Valid++
+		claimedIDs[row.Coupon.ID] = true
+		for _, code := range couponCodes(row.Coupon) {
+			claimedCodes[code] = true
+		}
+	}
+
+	if result.Invalid > 0 && mode == models.ImportAllOrNothing && !dryRun {
+		return result, ErrImportRejected.withDetails(map[string]interface{}{
+			"invalid": result.Invalid,
+			"rows":    result.Rows,
+		})
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	for i, row := range rows {
+		if result.Rows[i].Status != models.ImportRowValid {
+			continue
+		}
+		if err := createCoupon("import", row.Coupon, actor); err != nil {
+			// Rows were checked under the same lock, so this only happens if the checks
+			// and createCoupon disagree.
+			result.Rows[i].Status = models.ImportRowInvalid
+			result.Rows[i].Error = importError(err)
+			result.Valid--
+			result.Invalid++
+			continue
+		}
+		result.Rows[i].Status = models.ImportRowCreated
+		result.Created++
+	}
+	return result, nil
+}
+
+// ExportCoupons calls write for each of the tenant's coupons in ID order. The coupons are
+// copied first so a slow client does not hold the store lock.
+func ExportCoupons(tenant string, write func(models.Coupon) error) error {
+	couponsMutex.RLock()
+	var coupons []models.Coupon
+	for _, coupon := range Coupons {
+		if coupon.TenantID == tenant {
+			coupons = append(coupons, coupon)
+		}
+	}
+	couponsMutex.RUnlock()
+
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].ID < coupons[j].ID })
+	now := time.Now()
+	for _, coupon := range coupons {
+		if err := write(withEffectiveStatus(coupon, now)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importedCoupon drops the fields the service maintains, which an export carries: the
+// usage counter, version and timestamps. A paused or archived coupon is imported as a
+// draft, so importing an export never puts a withdrawn coupon back in front of shoppers.
+func importedCoupon(coupon models.Coupon, tenant string) models.Coupon {
+	coupon.TenantID = tenant
+	coupon.Details.Uses = 0
+	coupon.Version = 0
+	coupon.CreatedAt = time.Time{}
+	coupon.UpdatedAt = time.Time{}
+	if coupon.Status == models.StatusPaused || coupon.Status == models.StatusArchived {
+		coupon.Status = models.StatusDraft
+	}
+	return coupon
+}
+
+func checkImportedCoupon(coupon models.Coupon, claimedIDs, claimedCodes map[string]bool) error {
+	if err := checkNewCoupon(coupon); err != nil {
+		return err
+	}
+	if claimedIDs[coupon.ID] {
+		return &Error{Kind: ErrConflict, Code: "duplicate_row", Field: "id", Message: fmt.Sprintf("coupon %s appears more than once", coupon.ID)}
+	}
+	for _, code := range couponCodes(coupon) {
+		if claimedCodes[code] {
+			return &Error{Kind: ErrConflict, Code: "code_in_use", Field: "code", Message: fmt.Sprintf("coupon code already in use: %s", code)}
+		}
+	}
+	return nil
+}
+
+func importError(err error) *models.ImportError {
+	var serviceErr *Error
+	if errors.As(err, &serviceErr) {
+		return &models.ImportError{Code: serviceErr.Code, Message: serviceErr.Message, Field: serviceErr.Field}
+	}
+	return &models.ImportError{Code: "invalid_row", Message: err.Error()}
+}
+
+func findCouponColumn(name string) (couponColumn, bool) {
+	for _, column := range couponColumns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return couponColumn{}, false
+}
+
+func parseProducts(name, value string) ([]models.BuyProduct, error) {
+	var products []models.BuyProduct
+	for _, pair := range splitList(value) {
+		productID, quantity, found := strings.Cut(pair, ":")
+		parsed, err := strconv.Atoi(strings.TrimSpace(quantity))
+		if !found || err != nil {
+			return nil, invalidField("invalid_value", name, name+" must be product_id:quantity pairs separated by "+listSeparator)
+		}
+		products = append(products, models.BuyProduct{ProductID: strings.TrimSpace(productID), Quantity: parsed})
+	}
+	return products, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, item := range strings.Split(value, listSeparator) {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func stringColumn(name string, field func(*models.Coupon) *string) couponColumn {
+	return couponColumn{
+		name: name,
+		get:  func(c models.Coupon) string { return *field(&c) },
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func listColumn(name string, field func(*models.Coupon) *[]string) couponColumn {
+	return couponColumn{
+		name: name,
+		get:  func(c models.Coupon) string { return strings.Join(*field(&c), listSeparator) },
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			*field(c) = splitList(value)
+			return nil
+		},
+	}
+}
+
+func floatColumn(name string, field func(*models.Coupon) *float64) couponColumn {
+	return couponColumn{
+		name: name,
+		get: func(c models.Coupon) string {
+			if value := *field(&c); value != 0 {
+				return strconv.FormatFloat(value, 'f', -1, 64)
+			}
+			return ""
+		},
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			if value == "" {
+				return nil
+			}
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return invalidField("invalid_value", name, name+" must be a number")
+			}
+			*field(c) = parsed
+			return nil
+		},
+	}
+}
+
+func intColumn(name string, field func(*models.Coupon) *int) couponColumn {
+	return couponColumn{
+		name: name,
+		get: func(c models.Coupon) string {
+			if value := *field(&c); value != 0 {
+				return strconv.Itoa(value)
+			}
+			return ""
+		},
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			if value == "" {
+				return nil
+			}
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return invalidField("invalid_value", name, name+" must be an integer")
+			}
+			*field(c) = parsed
+			return nil
+		},
+	}
+}
+
+func boolColumn(name string, field func(*models.Coupon) *bool) couponColumn {
+	return couponColumn{
+		name: name,
+		get: func(c models.Coupon) string {
+			if *field(&c) {
+				return "true"
+			}
+			return ""
+		},
+		set: func(c *models.Coupon, value string, _ *time.Location) error {
+			if value == "" {
+				return nil
+			}
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return invalidField("invalid_value", name, name+" must be true or false")
+			}
+			*field(c) = parsed
+			return nil
+		},
+	}
+}
+
+func timeColumn(name string, field func(*models.Coupon) **time.Time) couponColumn {
+	return couponColumn{
+		name: name,
+		get: func(c models.Coupon) string {
+			if value := *field(&c); value != nil {
+				return value.Format(time.RFC3339)
+			}
+			return ""
+		},
+		set: func(c *models.Coupon, value string, location *time.Location) error {
+			if value == "" {
+				return nil
+			}
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				if parsed, err = time.ParseInLocation("2006-01-02", value, location); err != nil {
+					return invalidField("invalid_value", name, name+" must be an RFC 3339 timestamp or a date")
+				}
+			}
+			*field(c) = &parsed
+			return nil
+		},
+	}
+}
+
+func readOnlyColumn(name string, get func(models.Coupon) string) couponColumn {
+	return couponColumn{name: name, get: get}
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"bytes"
+	"coupon/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func resetImportStores() {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+}
+
+const importCSV = `id,type,code,threshold,discount,max_uses,expiry_date
+1,cart-wise,SAVE10,100,10,5,2030-01-01
+2,cart-wise,save10,50,5,,
+3,unknown,,,,,
+4,cart-wise,,abc,10,,
+`
+
+func TestImportCouponsDryRun(t *testing.T) {
+	resetImportStores()
+
+	rows, err := ReadCouponsCSV(strings.NewReader(importCSV), time.UTC)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	result, err := ImportCoupons("", rows, models.ImportAllOrNothing, true, models.Actor{})
+	if err != nil {
+		t.Fatalf("Expected a dry run to report rows instead of failing, got %v", err)
+	}
+	if result.Total != 4 || result.Valid != 1 || result.Invalid != 3 || result.Created != 0 {
+		t.Fatalf("Expected 1 valid and 3 invalid rows, got %+v", result)
+	}
+	if result.Rows[1].Error == nil || result.Rows[1].Error.Code != "code_in_use" {
+		t.Fatalf("Expected the second row to reuse the first row's code, got %+v", result.Rows[1])
+	}
+	if result.Rows[3].Error == nil || result.Rows[3].Error.Field != "threshold" {
+		t.Fatalf("Expected the fourth row to have a bad threshold, got %+v", result.Rows[3])
+	}
+	if len(Coupons) != 0 {
+		t.Fatalf("Expected a dry run to create nothing, got %d coupons", len(Coupons))
+	}
+}
+
+func TestImportCouponsAllOrNothing(t *testing.T) {
+	resetImportStores()
+
+	rows, _ := ReadCouponsCSV(strings.NewReader(importCSV), time.UTC)
+	_, err := ImportCoupons("", rows, "", false, models.Actor{})
+	if !errors.Is(err, ErrImportRejected) {
+		t.Fatalf("Expected the import to be rejected, got %v", err)
+	}
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || serviceErr.Details["invalid"] != 3 {
+		t.Fatalf("Expected the rejection to count the invalid rows, got %v", err)
+	}
+	if len(Coupons) != 0 {
+		t.Fatalf("Expected nothing to be created, got %d coupons", len(Coupons))
+	}
+}
+
+func TestImportCouponsBestEffort(t *testing.T) {
+	resetImportStores()
+
+	rows, _ := ReadCouponsCSV(strings.NewReader(importCSV), time.UTC)
+	result, err := ImportCoupons("", rows, models.ImportBestEffort, false, models.Actor{ID: "importer"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Created != 1 || result.Rows[0].Status != models.ImportRowCreated {
+		t.Fatalf("Expected the valid row to be created, got %+v", result)
+	}
+	coupon, err := GetCouponByID("1")
+	if err != nil {
+		t.Fatalf("Expected the imported coupon, got %v", err)
+	}
+	if coupon.Code != "SAVE10" || coupon.Details.MaxUses != 5 || coupon.Details.ExpiryDate == nil || coupon.Version != 1 {
+		t.Fatalf("Expected the row's values to be imported, got %+v", coupon)
+	}
+	if revisions := CouponRevisions[couponKey(coupon)]; len(revisions) != 1 || revisions[0].Action != "import" {
+		t.Fatalf("Expected an import revision, got %+v", revisions)
+	}
+
+	result, err = ImportCoupons("", rows[:1], models.ImportBestEffort, false, models.Actor{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Created != 0 || result.Rows[0].Error == nil || result.Rows[0].Error.Code != ErrCouponExists.Code {
+		t.Fatalf("Expected an existing coupon to be reported, got %+v", result.Rows[0])
+	}
+}
+
+func TestImportCouponsInvalidMode(t *testing.T) {
+	resetImportStores()
+
+	rows, _ := ReadCouponsJSON(strings.NewReader(`[{"id": "1", "type": "cart-wise", "details": {"threshold": 10, "discount": 5}}]`))
+	if _, err := ImportCoupons("", rows, "some", false, models.Actor{}); err == nil {
+		t.Fatalf("Expected an invalid mode error")
+	}
+	if _, err := ImportCoupons("", nil, "", false, models.Actor{}); err == nil {
+		t.Fatalf("Expected an empty import error")
+	}
+}
+
+func TestReadCouponsJSON(t *testing.T) {
+	rows, err := ReadCouponsJSON(strings.NewReader(`[{"id": "1", "type": "cart-wise"}, {"id": "2", "colour": "red"}]`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rows) != 2 || rows[0].Err != nil || rows[1].Err == nil {
+		t.Fatalf("Expected only the second row to fail, got %+v", rows)
+	}
+
+	if _, err := ReadCouponsJSON(strings.NewReader(`{"id": "1"}`)); err == nil {
+		t.Fatalf("Expected an error for a body that is not an array")
+	}
+}
+
+func TestReadCouponsCSVUnknownColumn(t *testing.T) {
+	if _, err := ReadCouponsCSV(strings.NewReader("id,colour\n1,red\n"), time.UTC); err == nil {
+		t.Fatalf("Expected an unknown column error")
+	}
+	if _, err := ReadCouponsCSV(strings.NewReader("id,id\n1,1\n"), time.UTC); err == nil {
+		t.Fatalf("Expected a duplicate column error")
+	}
+}
+
+func TestExportCouponsCSVRoundTrip(t *testing.T) {
+	resetImportStores()
+
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	CreateCoupon(models.Coupon{
+		ID:      "2",
+		Type:    "bxgy",
+		Code:    "BOGO",
+		Aliases: []string{"FREEBIE"},
+		Details: models.CouponDetails{
+			BuyProducts:     []models.BuyProduct{{ProductID: "A", Quantity: 2}},
+			GetProducts:     []models.GetProduct{{ProductID: "B", Quantity: 1}},
+			RepetitionLimit: 2,
+			ExpiryDate:      &expiry,
+			CustomerTiers:   []string{"gold", "silver"},
+		},
+	})
+	CreateCoupon(models.Coupon{ID: "1", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100, Discount: 10, Exclusive: true}})
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(CouponCSVHeader())
+	err := ExportCoupons("", func(coupon models.Coupon) error {
+		return writer.Write(CouponCSVRecord(coupon))
+	})
+	writer.Flush()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	exported := map[string]models.Coupon{}
+	for id, coupon := range Coupons {
+		exported[id] = coupon
+	}
+	resetImportStores()
+	rows, err := ReadCouponsCSV(&buffer, time.UTC)
+	if err != nil {
+		t.Fatalf("Expected the export to be readable, got %v", err)
+	}
+	if len(rows) != 2 || rows[0].Coupon.ID != "1" || rows[1].Coupon.ID != "2" {
+		t.Fatalf("Expected the coupons in ID order, got %+v", rows)
+	}
+	result, err := ImportCoupons("", rows, "", false, models.Actor{})
+	if err != nil || result.Created != 2 {
+		t.Fatalf("Expected both coupons to be imported, got %+v, %v", result, err)
+	}
+
+	bogo, _ := GetCouponByID("2")
+	original := exported[couponKey(bogo)]
+	if bogo.Code != original.Code || bogo.Aliases[0] != "FREEBIE" || bogo.Details.BuyProducts[0] != original.Details.BuyProducts[0] ||
+		bogo.Details.GetProducts[0] != original.Details.GetProducts[0] || !bogo.Details.ExpiryDate.Equal(expiry) ||
+		len(bogo.Details.CustomerTiers) != 2 || bogo.Details.RepetitionLimit != 2 {
+		t.Fatalf("Expected the coupon to survive the round trip, got %+v", bogo)
+	}
+	if cart, _ := GetCouponByID("1"); !cart.Details.Exclusive || cart.Details.Threshold != 100 {
+		t.Fatalf("Expected the cart-wise coupon to survive the round trip, got %+v", cart)
+	}
+}
+
+func TestImportCouponsLifecycleRoundTrip(t *testing.T) {
+	resetImportStores()
+
+	now := time.Now()
+	tomorrow, yesterday := now.Add(24*time.Hour), now.Add(-24*time.Hour)
+	cartWise := models.CouponDetails{Threshold: 100, Discount: 10, MaxUses: 3}
+	CreateCoupon(models.Coupon{ID: "draft", Type: "cart-wise", Status: models.StatusDraft, Details: cartWise})
+	CreateCoupon(models.Coupon{ID: "active", Type: "cart-wise", Details: cartWise})
+	scheduled := cartWise
+	scheduled.StartDate = &tomorrow
+	CreateCoupon(models.Coupon{ID: "scheduled", Type: "cart-wise", Details: scheduled})
+	expired := cartWise
+	expired.ExpiryDate = &yesterday
+	CreateCoupon(models.Coupon{ID: "expired", Type: "cart-wise", Details: expired})
+	exhausted := cartWise
+	exhausted.Uses = 3
+	CreateCoupon(models.Coupon{ID: "exhausted", Type: "cart-wise", Details: exhausted})
+	CreateCoupon(models.Coupon{ID: "paused", Type: "cart-wise", Details: cartWise})
+	CreateCoupon(models.Coupon{ID: "archived", Type: "cart-wise", Details: cartWise})
+	if _, err := TransitionCoupon("", "paused", "pause", 0, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := TransitionCoupon("", "archived", "archive", 0, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := map[string]string{
+		"draft":     models.StatusDraft,
+		"active":    models.StatusActive,
+		"scheduled": models.StatusScheduled,
+		"expired":   models.StatusActive,
+		"exhausted": models.StatusActive,
+		"paused":    models.StatusDraft,
+		"archived":  models.StatusDraft,
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(CouponCSVHeader())
+	ExportCoupons("", func(coupon models.Coupon) error { return writer.Write(CouponCSVRecord(coupon)) })
+	writer.Flush()
+	var exported []byte
+	ExportCoupons("", func(coupon models.Coupon) error {
+		encoded, _ := json.Marshal(coupon)
+		if len(exported) > 0 {
+			exported = append(exported, ',')
+		}
+		exported = append(exported, encoded...)
+		return nil
+	})
+
+	for format, read := range map[string]func() ([]CouponRow, error){
+		"csv": func() ([]CouponRow, error) { return ReadCouponsCSV(bytes.NewReader(buffer.Bytes()), time.UTC) },
+		"json": func() ([]CouponRow, error) {
+			return ReadCouponsJSON(bytes.NewReader(append(append([]byte("["), exported...), ']')))
+		},
+	} {
+		resetImportStores()
+		rows, err := read()
+		if err != nil {
+			t.Fatalf("%s: expected the export to be readable, got %v", format, err)
+		}
+		result, err := ImportCoupons("", rows, "", false, models.Actor{})
+		if err != nil || result.Created != len(want) {
+			t.Fatalf("%s: expected every lifecycle state to import, got %+v, %v", format, result, err)
+		}
+		for id, status := range want {
+			coupon, _ := GetCouponByID(id)
+			if effectiveStatus(coupon, now) != status || coupon.Details.Uses != 0 || coupon.Version != 1 {
+				t.Errorf("%s: expected %s to be imported as %s with no uses, got %s with %d uses", format, id, status, coupon.Status, coupon.Details.Uses)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import "coupon/models"
+
+// Secondary indexes over Coupons, keyed by type and by every product a coupon references
+// and holding tenant-scoped coupon IDs. They narrow the candidates for ListCoupons;
+// candidates are still checked against the query, so the indexes only need to be a
+// superset of the matching coupons.
+var (
+	couponsByType    = make(map[string]map[string]bool)
+	couponsByProduct = make(map[string]map[string]bool)
+)
+
+func indexCoupon(coupon models.Coupon) {
+	addToIndex(couponsByType, coupon.Type, couponKey(coupon))
+	for _, productID := range couponProducts(coupon) {
+		addToIndex(couponsByProduct, productID, couponKey(coupon))
+	}
+}
+
+func unindexCoupon(coupon models.Coupon) {
+	removeFromIndex(couponsByType, coupon.Type, couponKey(coupon))
+	for _, productID := range couponProducts(coupon) {
+		removeFromIndex(couponsByProduct, productID, couponKey(coupon))
+	}
+}
+
+func couponProducts(coupon models.Coupon) []string {
+	products := []string{}
+	if coupon.Details.ProductID != "" {
+		products = append(products, coupon.Details.ProductID)
+	}
+	for _, product := range coupon.Details.BuyProducts {
+		products = append(products, product.ProductID)
+	}
+	for _, product := range coupon.Details.GetProducts {
+		products = append(products, product.ProductID)
+	}
+	return products
+}
+
+func addToIndex(index map[string]map[string]bool, key, couponID string) {
+	if index[key] == nil {
+		index[key] = make(map[string]bool)
+	}
+	index[key][couponID] = true
+}
+
+func removeFromIndex(index map[string]map[string]bool, key, couponID string) {
+	delete(index[key], couponID)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"coupon/models"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+
+	sortKeyTimeLayout = "2006-01-02T15:04:05.000000000Z"
+)
+
+var couponSortKeys = map[string]func(models.Coupon) string{
+	"id": func(coupon models.Coupon) string { return coupon.ID },
+	"created_at": func(coupon models.Coupon) string {
+		return coupon.CreatedAt.UTC().Format(sortKeyTimeLayout)
+	},
+	"updated_at": func(coupon models.Coupon) string {
+		return coupon.UpdatedAt.UTC().Format(sortKeyTimeLayout)
+	},
+}
+
+type couponCursor struct {
+	Sort string `json:"s"`
+	Key  string `json:"k"`
+	ID   string `json:"id"`
+}
+
+// ListCoupons returns one page of the tenant's coupons matching the query in a stable
+// order. Sort is one of id, created_at or updated_at, optionally prefixed with "-" for
+// descending; ties are broken by ID so the cursor always identifies a unique position.
+func ListCoupons(query models.CouponQuery) (models.CouponPage, error) {
+	sortField, descending, err := parseCouponSort(query.Sort)
+	if err != nil {
+		return models.CouponPage{}, err
+	}
+	sortKey := couponSortKeys[sortField]
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit < 0 || limit > MaxPageSize {
+		return models.CouponPage{}, invalidField("invalid_limit", "limit", "limit must be between 1 and 500")
+	}
+
+	var cursor *couponCursor
+	if query.Cursor != "" {
+		if cursor, err = decodeCouponCursor(query.Cursor, query.Sort); err != nil {
+			return models.CouponPage{}, err
+		}
+	}
+
+	couponsMutex.RLock()
+	matches := []models.Coupon{}
+	now := time.Now()
+	for _, couponID := range candidateCouponIDs(query) {
+		coupon, exists := Coupons[couponID]
+		if exists && matchesCouponQuery(coupon, query, now) {
+			matches = append(matches, withEffectiveStatus(coupon, now))
+		}
+	}
+	couponsMutex.RUnlock()
+
+	compare := func(key, id string, coupon models.Coupon) int {
+		order := strings.Compare(key, sortKey(coupon))
+		if order == 0 {
+			order = strings.Compare(id, coupon.ID)
+		}
+		if descending {
+			return -order
+		}
+		return order
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return compare(sortKey(matches[i]), matches[i].ID, matches[j]) < 0
+	})
+
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			return compare(cursor.Key, cursor.ID, matches[i]) < 0
+		})
+	}
+	end := start + limit
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	page := models.CouponPage{Coupons: matches[start:end]}
+	if end < len(matches) {
+		last := matches[end-1]
+		page.NextCursor = encodeCouponCursor(couponCursor{Sort: query.Sort, Key: sortKey(last), ID: last.ID})
+	}
+	return page, nil
+}
+
+func parseCouponSort(value string) (string, bool, error) {
+	field := strings.TrimPrefix(value, "-")
+	if field == "" {
+		field = "id"
+	}
+	if _, exists := couponSortKeys[field]; !exists {
+		return "", false, invalidField("invalid_sort", "sort", "sort must be one of id, created_at or updated_at, optionally prefixed with -")
+	}
+	return field, strings.HasPrefix(value, "-"), nil
+}
+
+// candidateCouponIDs uses the type and product indexes to avoid scanning every coupon
+// when the query filters on either of them.
+func candidateCouponIDs(query models.CouponQuery) []string {
+	var candidates map[string]bool
+	narrow := func(index map[string]bool) {
+		if candidates == nil {
+			candidates = make(map[string]bool, len(index))
+			for couponID := range index {
+				candidates[couponID] = true
+			}
+			return
+		}
+		for couponID := range candidates {
+			if !index[couponID] {
+				delete(candidates, couponID)
+			}
+		}
+	}
+
+	if query.Type != "" {
+		narrow(couponsByType[query.Type])
+	}
+	if query.ProductID != "" {
+		narrow(couponsByProduct[query.ProductID])
+	}
+
+	ids := []string{}
+	if candidates == nil {
+		for couponID := range Coupons {
+			ids = append(ids, couponID)
+		}
+		return ids
+	}
+	for couponID := range candidates {
+		ids = append(ids, couponID)
+	}
+	return ids
+}
+
+func matchesCouponQuery(coupon models.Coupon, query models.CouponQuery, now time.Time) bool {
+	if coupon.TenantID != query.Tenant {
+		return false
+	}
+	if query.Type != "" && coupon.Type != query.Type {
+		return false
+	}
+	if query.Status != "" && effectiveStatus(coupon, now) != query.Status {
+		return false
+	}
+	if query.ProductID != "" && !containsString(couponProducts(coupon), query.ProductID) {
+		return false
+	}
+	if query.Expired != nil {
+		expired := coupon.Details.ExpiryDate != nil && now.After(*coupon.Details.ExpiryDate)
+		if expired != *query.Expired {
+			return false
+		}
+	}
+	if query.Exclusive != nil && coupon.Details.Exclusive != *query.Exclusive {
+		return false
+	}
+	if query.CodePrefix != "" && !hasCodePrefix(coupon, NormalizeCode(query.CodePrefix)) {
+		return false
+	}
+	if query.CreatedAfter != nil && coupon.CreatedAt.Before(*query.CreatedAfter) {
+		return false
+	}
+	if query.CreatedBefore != nil && !coupon.CreatedAt.Before(*query.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func hasCodePrefix(coupon models.Coupon, prefix string) bool {
+	for _, code := range couponCodes(coupon) {
+		if strings.HasPrefix(code, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCouponCursor(cursor couponCursor) string {
+	encoded, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCouponCursor(value, sortValue string) (*couponCursor, error) {
+	invalid := invalidField("invalid_cursor", "cursor", "cursor is invalid or was issued for a different sort order")
+
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor couponCursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil || cursor.Sort != sortValue {
+		return nil, invalid
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestListCoupons_Pagination(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	for i := 1; i <= 7; i++ {
+		CreateCoupon(models.Coupon{
+			ID:      fmt.Sprintf("c%d", i),
+			Type:    "cart-wise",
+			Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+		})
+	}
+
+	seen := []string{}
+	query := models.CouponQuery{Limit: 3}
+	for {
+		page, err := ListCoupons(query)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, coupon := range page.Coupons {
+			seen = append(seen, coupon.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if fmt.Sprint(seen) != "[c1 c2 c3 c4 c5 c6 c7]" {
+		t.Fatalf("Expected every coupon once in ID order, got %v", seen)
+	}
+
+	page, _ := ListCoupons(models.CouponQuery{Sort: "-id", Limit: 2})
+	if page.Coupons[0].ID != "c7" || page.Coupons[1].ID != "c6" {
+		t.Fatalf("Expected descending order, got %v", page.Coupons)
+	}
+
+	if _, err := ListCoupons(models.CouponQuery{Sort: "id", Cursor: page.NextCursor}); err == nil {
+		t.Fatalf("Expected cursor from a different sort order to be rejected")
+	}
+}
+
+func TestListCoupons_Filters(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	past := time.Now().Add(-time.Hour)
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Code:    "SPRING10",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5, ExpiryDate: &past},
+	})
+	CreateCoupon(models.Coupon{
+		ID:      "2",
+		Code:    "SPRING20",
+		Type:    "product-wise",
+		Details: models.CouponDetails{ProductID: "A123", Discount: 20.0, MaxUses: 5, Exclusive: true},
+	})
+	CreateCoupon(models.Coupon{
+		ID:   "3",
+		Type: "bxgy",
+		Details: models.CouponDetails{
+			BuyProducts:     []models.BuyProduct{{ProductID: "A123", Quantity: 2}},
+			GetProducts:     []models.GetProduct{{ProductID: "B456", Quantity: 1}},
+			RepetitionLimit: 1,
+			MaxUses:         5,
+		},
+	})
+
+	ids := func(query models.CouponQuery) string {
+		page, err := ListCoupons(query)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		result := []string{}
+		for _, coupon := range page.Coupons {
+			result = append(result, coupon.ID)
+		}
+		return fmt.Sprint(result)
+	}
+
+	yes, no := true, false
+	cases := []struct {
+		query    models.CouponQuery
+		expected string
+	}{
+		{models.CouponQuery{Type: "product-wise"}, "[2]"},
+		{models.CouponQuery{ProductID: "A123"}, "[2 3]"},
+		{models.CouponQuery{ProductID: "A123", Type: "bxgy"}, "[3]"},
+		{models.CouponQuery{Expired: &yes}, "[1]"},
+		{models.CouponQuery{Expired: &no}, "[2 3]"},
+		{models.CouponQuery{Exclusive: &yes}, "[2]"},
+		{models.CouponQuery{CodePrefix: "spring"}, "[1 2]"},
+	}
+	for _, c := range cases {
+		if got := ids(c.query); got != c.expected {
+			t.Fatalf("Query %+v: expected %s, got %s", c.query, c.expected, got)
+		}
+	}
+
+	DeleteCoupon("2")
+	if got := ids(models.CouponQuery{Type: "product-wise"}); got != "[]" {
+		t.Fatalf("Expected deleted coupon to leave the type index, got %s", got)
+	}
+}
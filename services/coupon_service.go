@@ -2,177 +2,315 @@ package services
 
 import (
 	"coupon/models"
-	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 )
 
+// Coupons is the coupon store, keyed by tenant-scoped coupon ID (see tenantKey).
 var Coupons = make(map[string]models.Coupon)
 
-func CreateCoupon(coupon models.Coupon) error {
-	if _, exists := Coupons[coupon.ID]; exists {
-		return errors.New("coupon already exists")
+// couponsMutex guards Coupons and every index derived from it (codes, generated codes and
+// the customer redemption ledger) so that limit checks and usage increments are atomic.
+var couponsMutex sync.RWMutex
+
+// AnyVersion disables the optimistic concurrency check on a mutation.
+const AnyVersion = 0
+
+// checkVersion is the compare half of compare-and-swap: the caller holds couponsMutex,
+// so a match here guarantees nobody else changed the coupon before it is written.
+func checkVersion(coupon models.Coupon, expectedVersion int) error {
+	if expectedVersion != AnyVersion && coupon.Version != expectedVersion {
+		return ErrVersionMismatch.withDetails(map[string]interface{}{
+			"expected_version": expectedVersion,
+			"current_version":  coupon.Version,
+		})
 	}
-	Coupons[coupon.ID] = coupon
 	return nil
 }
 
-func UpdateCoupon(couponID string, updatedCoupon models.Coupon) error {
-	coupon, exists := Coupons[couponID]
-	if !exists {
-		return errors.New("coupon not found")
-	}
+func CreateCoupon(coupon models.Coupon) error {
+	return CreateCouponAs(coupon, models.Actor{})
+}
+
+// CreateCouponAs creates a coupon in coupon.TenantID and records the actor on its first
+// revision.
+func CreateCouponAs(coupon models.Coupon, actor models.Actor) error {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
 
-	if err := validateCouponDetails(updatedCoupon.Details); err != nil {
+	return createCoupon("create", coupon, actor)
+}
+
+// createCoupon stores a new coupon and records it under action. The caller holds
+// couponsMutex.
+func createCoupon(action string, coupon models.Coupon, actor models.Actor) error {
+	if err := checkNewCoupon(coupon); err != nil {
 		return err
 	}
 
-	if isNoChangesProvided(updatedCoupon) {
-		return errors.New("no changes provided")
+	now := time.Now()
+	status, err := initialStatus(coupon, now)
+	if err != nil {
+		return err
 	}
 
-	updateCouponDetails(&coupon, updatedCoupon)
-	Coupons[couponID] = coupon
-
+	registerCodes(coupon)
+	coupon.Status = status
+	coupon.CodesOnly = false
+	// A coupon re-created under a deleted coupon's ID continues its revision numbering, so
+	// neither revisions nor ETags are ever reused.
+	coupon.Version = lastRevision(couponKey(coupon)) + 1
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = coupon.CreatedAt
+	Coupons[couponKey(coupon)] = coupon
+	indexCoupon(coupon)
+	recordRevision(action, nil, coupon, actor)
 	return nil
 }
 
-func validateCouponDetails(details models.CouponDetails) error {
-	if details.Threshold < 0 {
-		return errors.New("invalid threshold: cannot be negative")
-	}
-	if details.Discount < 0 || details.Discount > 100 {
-		return errors.New("invalid discount: must be between 0 and 100")
+// checkNewCoupon validates a coupon about to be created against the stored coupons and
+// codes. The caller holds couponsMutex.
+func checkNewCoupon(coupon models.Coupon) error {
+	if err := validateCoupon(coupon); err != nil {
+		return err
 	}
-	if details.MaxUses < 0 {
-		return errors.New("invalid max uses: must be positive")
+	if _, exists := Coupons[couponKey(coupon)]; exists {
+		return ErrCouponExists
 	}
-	if details.Uses > details.MaxUses {
-		return errors.New("uses cannot exceed max uses")
+	if err := checkCodes(coupon); err != nil {
+		return err
 	}
-	return nil
+	_, err := initialStatus(coupon, time.Now())
+	return err
 }
 
-func isNoChangesProvided(updatedCoupon models.Coupon) bool {
-	return updatedCoupon.Type == "" &&
-		updatedCoupon.Details.Threshold == 0 &&
-		updatedCoupon.Details.Discount == 0 &&
-		updatedCoupon.Details.MinCartValue == 0 &&
-		updatedCoupon.Details.MaxUses == 0 &&
-		updatedCoupon.Details.ProductID == "" &&
-		updatedCoupon.Details.ExpiryDate == nil &&
-		len(updatedCoupon.Details.BuyProducts) == 0 &&
-		len(updatedCoupon.Details.GetProducts) == 0 &&
-		updatedCoupon.Details.RepetitionLimit == 0
+// UpdateCoupon replaces the definition of a coupon in the default tenant, like PUT
+// /coupons/{id} without a version check.
+func UpdateCoupon(couponID string, updatedCoupon models.Coupon) error {
+	_, err := ReplaceCoupon(DefaultTenant, couponID, updatedCoupon, AnyVersion, models.Actor{})
+	return err
 }
 
-func updateCouponDetails(coupon *models.Coupon, updatedCoupon models.Coupon) {
-	coupon.Type = updatedCoupon.Type
+// ReplaceCoupon swaps the stored definition for a complete new one, provided the stored
+// coupon is still at expectedVersion (AnyVersion skips the check).
+func ReplaceCoupon(tenant, couponID string, replacement models.Coupon, expectedVersion int, actor models.Actor) (models.Coupon, error) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
 
-	if updatedCoupon.Details.Threshold > 0 {
-		coupon.Details.Threshold = updatedCoupon.Details.Threshold
-	}
-	if updatedCoupon.Details.Discount > 0 {
-		coupon.Details.Discount = updatedCoupon.Details.Discount
-	}
-	if updatedCoupon.Details.MinCartValue > 0 {
-		coupon.Details.MinCartValue = updatedCoupon.Details.MinCartValue
-	}
-	if updatedCoupon.Details.MaxUses > 0 {
-		coupon.Details.MaxUses = updatedCoupon.Details.MaxUses
+	coupon, exists := Coupons[tenantKey(tenant, couponID)]
+	if !exists {
+		return models.Coupon{}, ErrCouponNotFound
 	}
-	if updatedCoupon.Details.ProductID != "" {
-		coupon.Details.ProductID = updatedCoupon.Details.ProductID
+	if err := checkVersion(coupon, expectedVersion); err != nil {
+		return models.Coupon{}, err
 	}
-	if updatedCoupon.Details.ExpiryDate != nil {
-		coupon.Details.ExpiryDate = updatedCoupon.Details.ExpiryDate
+	if replacement.ID != "" && replacement.ID != couponID {
+		return models.Coupon{}, ErrCouponIDMismatch
 	}
-	coupon.Details.Exclusive = updatedCoupon.Details.Exclusive
 
-	if len(updatedCoupon.Details.BuyProducts) > 0 {
-		coupon.Details.BuyProducts = updatedCoupon.Details.BuyProducts
-	}
-	if len(updatedCoupon.Details.GetProducts) > 0 {
-		coupon.Details.GetProducts = updatedCoupon.Details.GetProducts
-	}
-	if updatedCoupon.Details.RepetitionLimit > 0 {
-		coupon.Details.RepetitionLimit = updatedCoupon.Details.RepetitionLimit
-	}
+	replacement.ID = couponID
+	return saveCoupon("replace", coupon, replacement, actor)
 }
 
+// saveCoupon validates and stores a new definition of an existing coupon, moving its
+// codes from the previous definition and recording the change as a revision. The usage
+// counter and codes-only flag are maintained by the service and carry over; the version
+// is bumped. A coupon never moves between tenants.
+func saveCoupon(action string, previous, coupon models.Coupon, actor models.Actor) (models.Coupon, error) {
+	coupon.TenantID = previous.TenantID
+	coupon.Details.Uses = previous.Details.Uses
+	coupon.Status = previous.Status
+	coupon.CodesOnly = previous.CodesOnly
+	coupon.Version = previous.Version + 1
+	coupon.CreatedAt = previous.CreatedAt
+	coupon.UpdatedAt = time.Now()
+
+	if err := validateCoupon(coupon); err != nil {
+		return models.Coupon{}, err
+	}
+	if err := checkCodes(coupon); err != nil {
+		return models.Coupon{}, err
+	}
+	unregisterCodes(previous)
+	registerCodes(coupon)
+	unindexCoupon(previous)
+	indexCoupon(coupon)
+	Coupons[couponKey(coupon)] = coupon
+	recordRevision(action, &previous, coupon, actor)
+	return coupon, nil
+}
+
+// GetAllCoupons returns the coupons of the default tenant.
 func GetAllCoupons() []models.Coupon {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	now := time.Now()
 	coupons := make([]models.Coupon, 0, len(Coupons))
 	for _, coupon := range Coupons {
-		coupons = append(coupons, coupon)
+		if coupon.TenantID == DefaultTenant {
+			coupons = append(coupons, withEffectiveStatus(coupon, now))
+		}
 	}
 	return coupons
 }
 
 func GetCouponByID(id string) (models.Coupon, error) {
-	coupon, exists := Coupons[id]
+	return GetTenantCoupon(DefaultTenant, id)
+}
+
+func GetTenantCoupon(tenant, id string) (models.Coupon, error) {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	coupon, err := getCouponByID(tenant, id)
+	if err != nil {
+		return coupon, err
+	}
+	return withEffectiveStatus(coupon, time.Now()), nil
+}
+
+func getCouponByID(tenant, id string) (models.Coupon, error) {
+	coupon, exists := Coupons[tenantKey(tenant, id)]
 	if !exists {
-		return models.Coupon{}, errors.New("coupon not found")
+		return models.Coupon{}, ErrCouponNotFound
 	}
 	return coupon, nil
 }
 
 func DeleteCoupon(id string) error {
-	if _, exists := Coupons[id]; !exists {
-		return errors.New("coupon not found")
+	return DeleteCouponVersion(DefaultTenant, id, AnyVersion, models.Actor{})
+}
+
+// DeleteCouponVersion deletes the coupon only if it is still at expectedVersion. Its
+// revision history is kept. A coupon that has been redeemed cannot be deleted, so its
+// redemptions and reports keep pointing at it; it is archived instead.
+func DeleteCouponVersion(tenant, id string, expectedVersion int, actor models.Actor) error {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	coupon, exists := Coupons[tenantKey(tenant, id)]
+	if !exists {
+		return ErrCouponNotFound
+	}
+	if err := checkVersion(coupon, expectedVersion); err != nil {
+		return err
 	}
-	delete(Coupons, id)
+	if coupon.Details.Uses > 0 {
+		return ErrCouponRedeemed
+	}
+	unregisterCodes(coupon)
+	unregisterGeneratedCodes(coupon)
+	unindexCoupon(coupon)
+	delete(Coupons, couponKey(coupon))
+
+	deleted := coupon
+	deleted.Version++
+	deleted.UpdatedAt = time.Now()
+	recordRevision("delete", &coupon, deleted, actor)
 	return nil
 }
 
 func ApplyCoupon(cart models.Cart, couponID string, appliedCoupons map[string]bool) (models.Cart, error) {
+	return ApplyCouponAs(cart, couponID, appliedCoupons, models.Actor{})
+}
+
+// ApplyCouponAs applies a coupon and records the actor in the audit trail.
+func ApplyCouponAs(cart models.Cart, couponID string, appliedCoupons map[string]bool, actor models.Actor) (models.Cart, error) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	updatedCart, err := applyCoupon(cart, couponID, "", appliedCoupons, actor)
+	observeApply(Coupons[tenantKey(cart.TenantID, couponID)].Type, cart, updatedCart, err)
+	return updatedCart, err
+}
+
+// applyCoupon prices and redeems a coupon, recording the use in the redemption ledger
+// under code when it was applied by code. A coupon with generated codes is only redeemed
+// through one of them. The caller holds couponsMutex.
+func applyCoupon(cart models.Cart, couponID, code string, appliedCoupons map[string]bool, actor models.Actor) (models.Cart, error) {
 	if len(cart.Items) == 0 {
-		return cart, errors.New("cart is empty")
+		return cart, ErrCartEmpty
 	}
 
-	coupon, exists := Coupons[couponID]
+	coupon, exists := Coupons[tenantKey(cart.TenantID, couponID)]
 	if !exists {
-		return cart, errors.New("coupon not found")
+		return cart, ErrCouponNotFound
 	}
-
-	if err := validateCouponApplication(coupon, appliedCoupons); err != nil {
-		return cart, err
+	if _, generated := GeneratedCodes[tenantKey(cart.TenantID, code)]; coupon.CodesOnly && !generated {
+		return cart, ErrGeneratedCodeRequired
 	}
 
-	discount, totalAmount, err := calculateDiscount(cart, coupon)
+	customer := cartCustomer(cart)
+	discount, totalAmount, err := priceCoupon(cart, coupon, customer, appliedCoupons)
 	if err != nil {
 		return cart, err
 	}
 
 	appliedCoupons[couponID] = true
 	coupon.Details.Uses++
-	Coupons[couponID] = coupon
+	Coupons[couponKey(coupon)] = coupon
 
 	discount = math.Round(discount*100) / 100
+	recordAudit(coupon.TenantID, "apply", couponID, actor, map[string]interface{}{
+		"uses": coupon.Details.Uses - 1,
+	}, map[string]interface{}{
+		"uses":            coupon.Details.Uses,
+		"coupon_revision": coupon.Version,
+		"customer_id":     customer.ID,
+		"discount":        discount,
+	})
+
 	cart.TotalPrice = totalAmount
 	cart.TotalDiscount += discount
 	cart.FinalPrice = totalAmount - discount
+	recordRedemption(coupon, code, cart, customer.ID, totalAmount, discount, time.Now())
 
 	return cart, nil
 }
 
-func validateCouponApplication(coupon models.Coupon, appliedCoupons map[string]bool) error {
+// priceCoupon validates the coupon for this cart and customer and calculates its discount
+// without recording a use, so it can back both apply and read-only evaluation.
+func priceCoupon(cart models.Cart, coupon models.Coupon, customer models.Customer, appliedCoupons map[string]bool) (float64, float64, error) {
+	if err := validateCouponApplication(coupon, customer, appliedCoupons); err != nil {
+		return 0, 0, err
+	}
+	return calculateDiscount(cart, coupon)
+}
+
+func validateCouponApplication(coupon models.Coupon, customer models.Customer, appliedCoupons map[string]bool) error {
 	if coupon.Type == "" {
-		return errors.New("invalid coupon type")
+		return ErrInvalidCouponType
+	}
+	if err := checkCouponActive(coupon, time.Now()); err != nil {
+		return err
 	}
 	if appliedCoupons[coupon.ID] {
-		return errors.New("coupon already applied")
+		return ErrCouponAlreadyApplied
 	}
 	if coupon.Details.ExpiryDate != nil && time.Now().After(*coupon.Details.ExpiryDate) {
-		return errors.New("coupon has expired")
+		return ErrCouponExpired
 	}
-	if coupon.Details.Uses >= coupon.Details.MaxUses {
-		return errors.New("coupon usage limit exceeded")
+	if coupon.Details.MaxUses > 0 && coupon.Details.Uses >= coupon.Details.MaxUses {
+		return ErrUsageLimitExceeded
+	}
+	if coupon.Details.MaxUsesPerCustomer > 0 {
+		if customer.ID == "" {
+			return ErrCustomerRequired
+		}
+		if customerUses(coupon, customer.ID) >= coupon.Details.MaxUsesPerCustomer {
+			return ErrCustomerLimitExceeded
+		}
 	}
 	if coupon.Details.Exclusive && len(appliedCoupons) > 0 {
-		return errors.New("this coupon cannot be combined with others")
+		return ErrNotCombinable
 	}
-	return nil
+	if err := checkCustomerEligibility(coupon, customer); err != nil {
+		return err
+	}
+	return checkOrderHistory(coupon, customer)
 }
 
 func calculateDiscount(cart models.Cart, coupon models.Coupon) (float64, float64, error) {
@@ -192,33 +330,33 @@ func calculateDiscount(cart models.Cart, coupon models.Coupon) (float64, float64
 	case "bxgy":
 		return calculateBxGyDiscount(cart, coupon, totalAmount)
 	default:
-		return 0, 0, fmt.Errorf("unsupported coupon type: %s", coupon.Type)
+		return 0, 0, notApplicable("unsupported_coupon_type", fmt.Sprintf("unsupported coupon type: %s", coupon.Type))
 	}
 }
 
 func calculateCartWiseDiscount(cart models.Cart, coupon models.Coupon, totalAmount float64) (float64, float64, error) {
 	if coupon.Details.Threshold <= 0 {
-		return 0, 0, errors.New("invalid threshold value in cart-wise coupon")
+		return 0, 0, ErrInvalidCartWiseThreshold
 	}
 	if coupon.Details.Discount <= 0 {
-		return 0, 0, errors.New("invalid discount value in cart-wise coupon")
+		return 0, 0, ErrInvalidCartWiseDiscount
 	}
 	if coupon.Details.MinCartValue > 0 && totalAmount < coupon.Details.MinCartValue {
-		return 0, 0, errors.New("cart value is below the minimum required for this coupon")
+		return 0, 0, ErrBelowMinCartValue.withShortfall(coupon.Details.MinCartValue, totalAmount)
 	}
 	if totalAmount >= coupon.Details.Threshold {
 		discount := (coupon.Details.Discount / 100) * totalAmount
 		return discount, totalAmount, nil
 	}
-	return 0, 0, errors.New("cart total does not meet the threshold for this coupon")
+	return 0, 0, ErrBelowThreshold.withShortfall(coupon.Details.Threshold, totalAmount)
 }
 
 func calculateProductWiseDiscount(cart models.Cart, coupon models.Coupon, totalAmount float64) (float64, float64, error) {
 	if coupon.Details.ProductID == "" {
-		return 0, 0, errors.New("invalid product ID in product-wise coupon")
+		return 0, 0, ErrInvalidProductWiseID
 	}
 	if coupon.Details.Discount <= 0 || coupon.Details.Discount > 100 {
-		return 0, 0, errors.New("invalid discount value in product-wise coupon")
+		return 0, 0, ErrInvalidProductDiscount
 	}
 	for _, item := range cart.Items {
 		if item.ProductID == coupon.Details.ProductID {
@@ -227,12 +365,14 @@ func calculateProductWiseDiscount(cart models.Cart, coupon models.Coupon, totalA
 			return discount, totalAmount, nil
 		}
 	}
-	return 0, 0, errors.New("coupon cannot be applied to one or more products in your cart")
+	return 0, 0, ErrExcludedProducts.withMissingProducts([]models.BuyProduct{
+		{ProductID: coupon.Details.ProductID, Quantity: 1},
+	})
 }
 
 func calculateBxGyDiscount(cart models.Cart, coupon models.Coupon, totalAmount float64) (float64, float64, error) {
 	if len(coupon.Details.BuyProducts) == 0 || len(coupon.Details.GetProducts) == 0 || coupon.Details.RepetitionLimit <= 0 {
-		return 0, 0, errors.New("invalid BxGy coupon details")
+		return 0, 0, ErrInvalidBxGyDetails
 	}
 
 	buyProductMap := make(map[string]int)
@@ -262,5 +402,12 @@ func calculateBxGyDiscount(cart models.Cart, coupon models.Coupon, totalAmount f
 		}
 		return discount, totalAmount, nil
 	}
-	return 0, 0, errors.New("insufficient buy products for applying BxGy coupon")
+
+	missingProducts := []models.BuyProduct{}
+	for _, buyProduct := range coupon.Details.BuyProducts {
+		if missing := buyProduct.Quantity - buyProductMap[buyProduct.ProductID]; missing > 0 {
+			missingProducts = append(missingProducts, models.BuyProduct{ProductID: buyProduct.ProductID, Quantity: missing})
+		}
+	}
+	return 0, 0, ErrInsufficientBuyItems.withMissingProducts(missingProducts)
 }
@@ -2,6 +2,7 @@ package services
 
 import (
 	"coupon/models"
+	"errors"
 	"testing"
 	"time"
 )
@@ -54,11 +55,14 @@ func TestUpdateCoupon(t *testing.T) {
 		t.Fatalf("Expected no error when creating the coupon, got %v", err)
 	}
 
+	// An update replaces the whole definition, as PUT does.
 	updatedCoupon := models.Coupon{
 		Type: "cart-wise",
 		Details: models.CouponDetails{
-			Threshold: 200.0,
-			Discount:  20.0,
+			Threshold:    200.0,
+			Discount:     20.0,
+			MinCartValue: 50.0,
+			MaxUses:      5,
 		},
 	}
 
@@ -114,7 +118,10 @@ func TestUpdateCoupon_EdgeCases(t *testing.T) {
 	}
 
 	invalidCoupon := models.Coupon{
+		Type: "product-wise",
 		Details: models.CouponDetails{
+			ProductID: "A123",
+			Discount:  10.0,
 			Threshold: -10.0,
 		},
 	}
@@ -123,11 +130,8 @@ func TestUpdateCoupon_EdgeCases(t *testing.T) {
 		t.Fatalf("Expected 'invalid threshold: cannot be negative', got %v", err)
 	}
 
-	invalidCoupon = models.Coupon{
-		Details: models.CouponDetails{
-			Discount: 150.0,
-		},
-	}
+	invalidCoupon = coupon
+	invalidCoupon.Details.Discount = 150.0
 	err = UpdateCoupon("1", invalidCoupon)
 	if err == nil || err.Error() != "invalid discount: must be between 0 and 100" {
 		t.Fatalf("Expected 'invalid discount: must be between 0 and 100', got %v", err)
@@ -135,8 +139,8 @@ func TestUpdateCoupon_EdgeCases(t *testing.T) {
 
 	emptyCoupon := models.Coupon{}
 	err = UpdateCoupon("1", emptyCoupon)
-	if err == nil || err.Error() != "no changes provided" {
-		t.Fatalf("Expected 'no changes provided', got %v", err)
+	if err == nil || err.Error() != "coupon type is required" {
+		t.Fatalf("Expected 'coupon type is required', got %v", err)
 	}
 }
 
@@ -224,6 +228,27 @@ func TestDeleteCoupon(t *testing.T) {
 	}
 }
 
+func TestDeleteCoupon_Redeemed(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0},
+	})
+	cart := models.Cart{Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 100.0}}}
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := DeleteCoupon("1"); !errors.Is(err, ErrCouponRedeemed) {
+		t.Fatalf("Expected a redeemed coupon to be kept, got %v", err)
+	}
+	if _, err := TransitionCoupon(DefaultTenant, "1", "archive", AnyVersion, models.Actor{}); err != nil {
+		t.Fatalf("Expected the coupon to be archived instead, got %v", err)
+	}
+}
+
 func TestApplyCoupon_EmptyCart(t *testing.T) {
 	cart := models.Cart{Items: []models.CartItem{}}
 	_, err := ApplyCoupon(cart, "1", make(map[string]bool))
@@ -299,6 +324,33 @@ func TestApplyCoupon_UsageLimitExceeded(t *testing.T) {
 	}
 }
 
+func TestApplyCoupon_NoUsageLimit(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0},
+	}
+	if err := CreateCoupon(coupon); err != nil {
+		t.Fatalf("Expected a coupon without max_uses to be valid, got %v", err)
+	}
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+			t.Fatalf("Expected a coupon without max_uses to have no limit, got %v", err)
+		}
+	}
+	if uses := Coupons["1"].Details.Uses; uses != 3 {
+		t.Fatalf("Expected 3 uses, got %d", uses)
+	}
+}
+
 func TestApplyCoupon_ExclusiveCoupon(t *testing.T) {
 	Coupons = make(map[string]models.Coupon)
 
@@ -344,3 +396,93 @@ func TestApplyCoupon_ExclusiveCoupon(t *testing.T) {
 		t.Fatalf("Expected coupon1 usage count to be 1, got %d", Coupons["1"].Details.Uses)
 	}
 }
+
+func TestReplaceCoupon(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	coupon := models.Coupon{
+		ID:   "1",
+		Code: "SAVE10",
+		Type: "cart-wise",
+		Details: models.CouponDetails{
+			Threshold:    100.0,
+			Discount:     10.0,
+			MinCartValue: 50.0,
+			MaxUses:      5,
+			Uses:         2,
+		},
+	}
+	CreateCoupon(coupon)
+
+	replacement := models.Coupon{
+		Type:    "product-wise",
+		Details: models.CouponDetails{ProductID: "A123", Discount: 20.0, MaxUses: 5},
+	}
+	if _, err := ReplaceCoupon(DefaultTenant, "1", replacement, AnyVersion, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	replaced, _ := GetCouponByID("1")
+	if replaced.Type != "product-wise" || replaced.Details.MinCartValue != 0 || replaced.Code != "" {
+		t.Fatalf("Expected a full replacement, got %+v", replaced)
+	}
+	if replaced.Details.Uses != 2 {
+		t.Fatalf("Expected uses to carry over as 2, got %d", replaced.Details.Uses)
+	}
+	if _, err := GetCouponByCode(DefaultTenant, "SAVE10"); err == nil {
+		t.Fatalf("Expected dropped code to be released")
+	}
+
+	_, err := ReplaceCoupon(DefaultTenant, "1", models.Coupon{Type: "cart-wise", Details: models.CouponDetails{MaxUses: 5}}, AnyVersion, models.Actor{})
+	if err == nil || err.Error() != "threshold is required for cart-wise coupons; discount is required for cart-wise coupons" {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+
+	_, err = ReplaceCoupon(DefaultTenant, "1", models.Coupon{ID: "2", Type: "product-wise", Details: replacement.Details}, AnyVersion, models.Actor{})
+	if err == nil || err.Error() != "coupon ID cannot be changed" {
+		t.Fatalf("Expected 'coupon ID cannot be changed', got %v", err)
+	}
+}
+
+func TestReplaceCoupon_VersionMismatch(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	CouponCodes = make(map[string]string)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}
+	CreateCoupon(coupon)
+
+	if Coupons["1"].Version != 1 {
+		t.Fatalf("Expected new coupon at version 1, got %d", Coupons["1"].Version)
+	}
+
+	coupon.Details.Discount = 15.0
+	replaced, err := ReplaceCoupon(DefaultTenant, "1", coupon, 1, models.Actor{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if replaced.Version != 2 {
+		t.Fatalf("Expected version 2, got %d", replaced.Version)
+	}
+
+	coupon.Details.Discount = 20.0
+	_, err = ReplaceCoupon(DefaultTenant, "1", coupon, 1, models.Actor{})
+	if !errors.Is(err, ErrPrecondition) {
+		t.Fatalf("Expected precondition error for stale version, got %v", err)
+	}
+	if Coupons["1"].Details.Discount != 15.0 {
+		t.Fatalf("Expected stale write to be rejected, got discount %f", Coupons["1"].Details.Discount)
+	}
+
+	if err := DeleteCouponVersion(DefaultTenant, "1", 1, models.Actor{}); !errors.Is(err, ErrPrecondition) {
+		t.Fatalf("Expected precondition error for stale delete, got %v", err)
+	}
+	if err := DeleteCouponVersion(DefaultTenant, "1", 2, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"coupon/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// couponStoreFlushInterval is the longest a change waits before it is written. Changes
+// made within it are written together.
+const couponStoreFlushInterval = time.Second
+
+// CouponStorage persists the coupon store. It is nil when coupons are kept only in
+// memory.
+var CouponStorage *CouponStore
+
+// CouponStore saves the coupons, their revisions, generated codes and the redemption
+// ledger to a file. Every change marks the store dirty, and a background writer saves a
+// snapshot at most once per couponStoreFlushInterval, replacing the file atomically so a
+// crash leaves either the old or the new snapshot. Close writes any pending change.
+type CouponStore struct {
+	path    string
+	dirty   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	// mutex keeps the background writer and Close from writing at the same time.
+	mutex sync.Mutex
+}
+
+// couponSnapshot is the saved form of the store. Maps keep their tenant-scoped keys, and
+// the tenant fields the models leave out of JSON are restored from them on load.
+type couponSnapshot struct {
+	Coupons        map[string]models.Coupon           `json:"coupons"`
+	Revisions      map[string][]models.CouponRevision `json:"revisions"`
+	GeneratedCodes map[string]models.GeneratedCode    `json:"generated_codes"`
+	Redemptions    map[string][]models.Redemption     `json:"redemptions"`
+}
+
+// OpenCouponStore loads the snapshot at path, if there is one, in place of the in-memory
+// store and starts the background writer.
+func OpenCouponStore(path string) (*CouponStore, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var snapshot couponSnapshot
+		if err := json.Unmarshal(content, &snapshot); err != nil {
+			return nil, fmt.Errorf("invalid coupon store: %v", err)
+		}
+		loadCouponSnapshot(snapshot)
+	}
+
+	store := &CouponStore{
+		path:    path,
+		dirty:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go store.run()
+	return store, nil
+}
+
+// Close stops the background writer and writes the store one last time.
+func (s *CouponStore) Close() error {
+	close(s.done)
+	<-s.stopped
+	return s.save()
+}
+
+func (s *CouponStore) markDirty() {
+	select {
+	case s.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (s *CouponStore) run() {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.dirty:
+		case <-s.done:
+			return
+		}
+		select {
+		case <-time.After(couponStoreFlushInterval):
+		case <-s.done:
+			// Close writes the pending change.
+			return
+		}
+		if err := s.save(); err != nil {
+			slog.Error("failed to save coupon store", "path", s.path, "error", err)
+		}
+	}
+}
+
+// save writes a snapshot to a temporary file next to the store, syncs it and renames it
+// over the store.
+func (s *CouponStore) save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	content, err := json.Marshal(takeCouponSnapshot())
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
+
+// takeCouponSnapshot copies the store maps under couponsMutex so they can be encoded
+// without holding it. Copying the maps is enough: coupons and codes are replaced rather
+// than modified, and the revision and redemption slices are only ever appended to, which
+// never changes the elements a copied slice already covers.
+func takeCouponSnapshot() couponSnapshot {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	return couponSnapshot{
+		Coupons:        maps.Clone(Coupons),
+		Revisions:      maps.Clone(CouponRevisions),
+		GeneratedCodes: maps.Clone(GeneratedCodes),
+		Redemptions:    maps.Clone(Redemptions),
+	}
+}
+
+// loadCouponSnapshot replaces the in-memory store and rebuilds the code and coupon
+// indexes from the loaded coupons.
+func loadCouponSnapshot(snapshot couponSnapshot) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	couponsByType = make(map[string]map[string]bool)
+	couponsByProduct = make(map[string]map[string]bool)
+	for key, coupon := range snapshot.Coupons {
+		coupon.TenantID = tenantOfKey(key)
+		Coupons[key] = coupon
+		registerCodes(coupon)
+		indexCoupon(coupon)
+	}
+
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+	for key, code := range snapshot.GeneratedCodes {
+		code.TenantID = tenantOfKey(key)
+		GeneratedCodes[key] = code
+	}
+
+	Redemptions = make(map[string][]models.Redemption)
+	for tenant, ledger := range snapshot.Redemptions {
+		for i := range ledger {
+			ledger[i].TenantID = tenant
+		}
+		Redemptions[tenant] = ledger
+	}
+
+	CouponRevisions = snapshot.Revisions
+	if CouponRevisions == nil {
+		CouponRevisions = make(map[string][]models.CouponRevision)
+	}
+}
+
+// tenantOfKey is the tenant of a key built by tenantKey.
+func tenantOfKey(key string) string {
+	tenant, _, found := strings.Cut(key, "\x00")
+	if !found || tenant == "" {
+		return DefaultTenant
+	}
+	return tenant
+}
+
+// couponStoreChanged schedules a save after a change to the coupon store. Callers hold
+// couponsMutex.
+func couponStoreChanged() {
+	if CouponStorage != nil {
+		CouponStorage.markDirty()
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"coupon/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestCouponStore(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+	Redemptions = make(map[string][]models.Redemption)
+	defer func() { CouponStorage = nil }()
+
+	path := filepath.Join(t.TempDir(), "coupons.json")
+	store, err := OpenCouponStore(path)
+	if err != nil {
+		t.Fatalf("Expected a missing store to open empty, got %v", err)
+	}
+	CouponStorage = store
+
+	CreateCouponAs(models.Coupon{
+		ID:       "1",
+		TenantID: "acme",
+		Type:     "cart-wise",
+		Code:     "SAVE10",
+		Details:  models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}, models.Actor{ID: "marketing"})
+	var generated models.GeneratedCode
+	GenerateCodes("acme", "1", models.CodeBatchRequest{Count: 1, MaxUses: 1}, func(code models.GeneratedCode) error {
+		generated = code
+		return nil
+	})
+	cart := models.Cart{TenantID: "acme", CustomerID: "c1", Items: []models.CartItem{{ProductID: "A123", Quantity: 2, Price: 75.0}}}
+	if _, err := ApplyCouponByCode(cart, generated.Code, make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	GeneratedCodes = make(map[string]models.GeneratedCode)
+	Redemptions = make(map[string][]models.Redemption)
+
+	store, err = OpenCouponStore(path)
+	if err != nil {
+		t.Fatalf("Expected the store to load, got %v", err)
+	}
+	defer store.Close()
+
+	coupon, err := GetCouponByCode("acme", "save10")
+	if err != nil || coupon.TenantID != "acme" || coupon.Details.Uses != 1 || coupon.Version != 1 || !coupon.CodesOnly {
+		t.Fatalf("Expected the coupon, its code and its uses to be restored, got %+v, %v", coupon, err)
+	}
+	if _, err := GetCouponByCode("acme", generated.Code); err != nil || GeneratedCodes[tenantKey("acme", generated.Code)].Uses != 1 {
+		t.Fatalf("Expected the generated code and its uses to be restored, got %v", err)
+	}
+	if revisions := CouponRevisions[couponKey(coupon)]; len(revisions) != 1 || revisions[0].Actor.ID != "marketing" {
+		t.Fatalf("Expected the revision to be restored, got %+v", revisions)
+	}
+	if redemptions, _ := QueryRedemptions(models.RedemptionQuery{Tenant: "acme"}); len(redemptions) != 1 || redemptions[0].Discount != 15.0 {
+		t.Fatalf("Expected the redemption ledger to be restored, got %+v", redemptions)
+	}
+	if history := GetCustomerRedemptions("acme", "c1"); len(history) != 1 {
+		t.Fatalf("Expected the customer's redemptions to be restored, got %+v", history)
+	}
+	page, err := ListCoupons(models.CouponQuery{Tenant: "acme", Type: "cart-wise"})
+	if err != nil || len(page.Coupons) != 1 {
+		t.Fatalf("Expected the type index to be rebuilt, got %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,36 @@
+package services
+
+import "coupon/models"
+
+// customerUses counts the customer's redemptions of the coupon in the redemption ledger.
+// The caller holds couponsMutex.
+func customerUses(coupon models.Coupon, customerID string) int {
+	uses := 0
+	for _, redemption := range Redemptions[coupon.TenantID] {
+		if redemption.CouponID == coupon.ID && redemption.CustomerID == customerID {
+			uses++
+		}
+	}
+	return uses
+}
+
+// GetCustomerRedemptions lists the customer's redemptions from the redemption ledger,
+// oldest first.
+func GetCustomerRedemptions(tenant, customerID string) []models.CustomerRedemption {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	redemptions := []models.CustomerRedemption{}
+	for _, redemption := range Redemptions[tenant] {
+		if redemption.CustomerID != customerID {
+			continue
+		}
+		redemptions = append(redemptions, models.CustomerRedemption{
+			CouponID:       redemption.CouponID,
+			CouponRevision: redemption.CouponRevision,
+			CustomerID:     redemption.CustomerID,
+			RedeemedAt:     redemption.RedeemedAt,
+		})
+	}
+	return redemptions
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"coupon/models"
+	"testing"
+)
+
+func TestApplyCoupon_CustomerUsageLimit(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	Redemptions = make(map[string][]models.Redemption)
+
+	coupon := models.Coupon{
+		ID:   "1",
+		Type: "cart-wise",
+		Details: models.CouponDetails{
+			Threshold:          100.0,
+			Discount:           10.0,
+			MaxUses:            10,
+			MaxUsesPerCustomer: 1,
+		},
+	}
+	CreateCoupon(coupon)
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+	}
+
+	_, err := ApplyCoupon(cart, "1", make(map[string]bool))
+	if err == nil || err.Error() != "customer ID is required for this coupon" {
+		t.Fatalf("Expected 'customer ID is required for this coupon' error, got %v", err)
+	}
+
+	cart.CustomerID = "cust-1"
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	_, err = ApplyCoupon(cart, "1", make(map[string]bool))
+	if err == nil || err.Error() != "customer usage limit exceeded" {
+		t.Fatalf("Expected 'customer usage limit exceeded' error, got %v", err)
+	}
+
+	cart.CustomerID = "cust-2"
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected another customer to redeem, got %v", err)
+	}
+
+	redemptions := GetCustomerRedemptions(DefaultTenant, "cust-1")
+	if len(redemptions) != 1 || redemptions[0].CouponID != "1" {
+		t.Fatalf("Expected one redemption of coupon 1 for cust-1, got %v", redemptions)
+	}
+	if Coupons["1"].Details.Uses != 2 {
+		t.Fatalf("Expected global uses to be 2, got %d", Coupons["1"].Details.Uses)
+	}
+}
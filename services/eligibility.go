@@ -0,0 +1,70 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cartCustomer returns the customer context carried by the cart, falling back to the
+// bare customer_id for callers that only send an ID.
+func cartCustomer(cart models.Cart) models.Customer {
+	customer := models.Customer{}
+	if cart.Customer != nil {
+		customer = *cart.Customer
+	}
+	if customer.ID == "" {
+		customer.ID = cart.CustomerID
+	}
+	return customer
+}
+
+func checkCustomerEligibility(coupon models.Coupon, customer models.Customer) error {
+	details := coupon.Details
+
+	if len(details.CustomerIDs) > 0 {
+		if customer.ID == "" {
+			return ErrCustomerRequired
+		}
+		if !containsFold(details.CustomerIDs, customer.ID) {
+			return ErrCustomerNotAllowed
+		}
+	}
+	if len(details.CustomerTiers) > 0 && !containsFold(details.CustomerTiers, customer.Tier) {
+		return notApplicable("customer_tier_not_eligible", fmt.Sprintf("coupon is only available to customer tiers: %s", strings.Join(details.CustomerTiers, ", ")))
+	}
+	if len(details.CustomerTags) > 0 && !anyContainsFold(details.CustomerTags, customer.Tags) {
+		return notApplicable("customer_tags_not_eligible", fmt.Sprintf("coupon is only available to customers tagged: %s", strings.Join(details.CustomerTags, ", ")))
+	}
+	if details.NewCustomersOnly && !customer.FirstOrder {
+		return ErrNewCustomersOnly
+	}
+	if details.MaxAccountAgeDays > 0 {
+		if customer.SignupDate == nil {
+			return ErrSignupDateRequired
+		}
+		if time.Since(*customer.SignupDate) > time.Duration(details.MaxAccountAgeDays)*24*time.Hour {
+			return notApplicable("account_too_old", fmt.Sprintf("coupon is only available to customers who signed up in the last %d days", details.MaxAccountAgeDays))
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyContainsFold(values []string, targets []string) bool {
+	for _, target := range targets {
+		if containsFold(values, target) {
+			return true
+		}
+	}
+	return false
+}
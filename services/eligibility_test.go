@@ -0,0 +1,81 @@
+package services
+
+import (
+	"coupon/models"
+	"testing"
+	"time"
+)
+
+func TestApplyCoupon_CustomerEligibility(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+
+	coupon := models.Coupon{
+		ID:   "1",
+		Type: "cart-wise",
+		Details: models.CouponDetails{
+			Threshold:     100.0,
+			Discount:      10.0,
+			MaxUses:       10,
+			CustomerTiers: []string{"vip"},
+			CustomerTags:  []string{"employee"},
+		},
+	}
+	CreateCoupon(coupon)
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+		Customer: &models.Customer{ID: "cust-1", Tier: "standard", Tags: []string{"employee"}},
+	}
+
+	_, err := ApplyCoupon(cart, "1", make(map[string]bool))
+	if err == nil || err.Error() != "coupon is only available to customer tiers: vip" {
+		t.Fatalf("Expected tier rejection, got %v", err)
+	}
+
+	cart.Customer.Tier = "VIP"
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cart.Customer.Tags = nil
+	_, err = ApplyCoupon(cart, "1", make(map[string]bool))
+	if err == nil || err.Error() != "coupon is only available to customers tagged: employee" {
+		t.Fatalf("Expected tag rejection, got %v", err)
+	}
+}
+
+func TestCheckCustomerEligibility_NewCustomers(t *testing.T) {
+	coupon := models.Coupon{
+		ID: "1",
+		Details: models.CouponDetails{
+			NewCustomersOnly:  true,
+			MaxAccountAgeDays: 30,
+			CustomerIDs:       []string{"cust-1"},
+		},
+	}
+
+	signup := time.Now().Add(-10 * 24 * time.Hour)
+	customer := models.Customer{ID: "cust-1", FirstOrder: true, SignupDate: &signup}
+	if err := checkCustomerEligibility(coupon, customer); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	customer.FirstOrder = false
+	if err := checkCustomerEligibility(coupon, customer); err == nil || err.Error() != "coupon is only available to new customers" {
+		t.Fatalf("Expected new customers rejection, got %v", err)
+	}
+
+	customer.FirstOrder = true
+	oldSignup := time.Now().Add(-60 * 24 * time.Hour)
+	customer.SignupDate = &oldSignup
+	if err := checkCustomerEligibility(coupon, customer); err == nil || err.Error() != "coupon is only available to customers who signed up in the last 30 days" {
+		t.Fatalf("Expected account age rejection, got %v", err)
+	}
+
+	customer.ID = "cust-2"
+	if err := checkCustomerEligibility(coupon, customer); err == nil || err.Error() != "coupon is not available for this customer" {
+		t.Fatalf("Expected allow-list rejection, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"math"
+)
+
+// Error kinds. Every Error wraps one of these so callers can map failures to a status
+// with errors.Is without matching on message text.
+var (
+	ErrInvalid              = errors.New("invalid request")
+	ErrNotFound             = errors.New("not found")
+	ErrConflict             = errors.New("conflict")
+	ErrNotApplicable        = errors.New("coupon not applicable")
+	ErrTooLarge             = errors.New("request too large")
+	ErrUnsupported          = errors.New("unsupported media type")
+	ErrPrecondition         = errors.New("precondition failed")
+	ErrPreconditionRequired = errors.New("precondition required")
+	ErrUnauthorized         = errors.New("unauthorized")
+	ErrForbidden            = errors.New("forbidden")
+	ErrUnavailable          = errors.New("service unavailable")
+	ErrTooManyRequests      = errors.New("too many requests")
+)
+
+// Error is a service failure with a stable machine-readable code. Message keeps the
+// human-readable text the API has always returned.
+type Error struct {
+	Kind    error                  `json:"-"`
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Field   string                 `json:"field,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Is matches copies of a sentinel that carry request-specific details.
+func (e *Error) Is(target error) bool {
+	sentinel, ok := target.(*Error)
+	return ok && sentinel.Code == e.Code && sentinel.Message == e.Message
+}
+
+func (e *Error) withDetails(details map[string]interface{}) *Error {
+	detailed := *e
+	detailed.Details = details
+	return &detailed
+}
+
+// withShortfall records how far the cart total is from the amount the coupon requires.
+func (e *Error) withShortfall(required, cartTotal float64) *Error {
+	return e.withDetails(map[string]interface{}{
+		"required":   required,
+		"cart_total": cartTotal,
+		"shortfall":  math.Round((required-cartTotal)*100) / 100,
+	})
+}
+
+// withMissingProducts records the products (and quantities) the cart still needs.
+func (e *Error) withMissingProducts(products []models.BuyProduct) *Error {
+	return e.withDetails(map[string]interface{}{
+		"missing_products": products,
+	})
+}
+
+func newError(kind error, code, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+func invalidField(code, field, message string) *Error {
+	return &Error{Kind: ErrInvalid, Code: code, Field: field, Message: message}
+}
+
+func notApplicable(code, message string) *Error {
+	return &Error{Kind: ErrNotApplicable, Code: code, Message: message}
+}
+
+// Sentinel errors for failures with a fixed message.
+var (
+	ErrCouponNotFound           = newError(ErrNotFound, "coupon_not_found", "coupon not found")
+	ErrCouponExists             = newError(ErrConflict, "coupon_exists", "coupon already exists")
+	ErrCouponRedeemed           = newError(ErrConflict, "coupon_redeemed", "coupon has been redeemed and cannot be deleted; archive it instead")
+	ErrCouponIDMismatch         = invalidField("id_mismatch", "id", "coupon ID cannot be changed")
+	ErrVersionMismatch          = newError(ErrPrecondition, "version_mismatch", "coupon has been modified since it was read")
+	ErrCartEmpty                = invalidField("cart_empty", "cart.items", "cart is empty")
+	ErrInvalidCouponType        = newError(ErrNotApplicable, "invalid_coupon_type", "invalid coupon type")
+	ErrCouponAlreadyApplied     = notApplicable("coupon_already_applied", "coupon already applied")
+	ErrCouponNotActive          = notApplicable("coupon_not_active", "coupon is not active")
+	ErrCouponNotStarted         = notApplicable("coupon_not_started", "coupon is not active yet")
+	ErrCouponExpired            = notApplicable("coupon_expired", "coupon has expired")
+	ErrUsageLimitExceeded       = notApplicable("usage_limit_exceeded", "coupon usage limit exceeded")
+	ErrCustomerRequired         = invalidField("customer_required", "cart.customer.id", "customer ID is required for this coupon")
+	ErrCustomerLimitExceeded    = notApplicable("customer_usage_limit_exceeded", "customer usage limit exceeded")
+	ErrNotCombinable            = notApplicable("coupon_not_combinable", "this coupon cannot be combined with others")
+	ErrCodeRedeemed             = notApplicable("code_already_redeemed", "coupon code has already been redeemed")
+	ErrGeneratedCodeRequired    = notApplicable("generated_code_required", "coupon can only be redeemed with one of its generated codes")
+	ErrBelowMinCartValue        = notApplicable("below_min_cart_value", "cart value is below the minimum required for this coupon")
+	ErrBelowThreshold           = notApplicable("below_threshold", "cart total does not meet the threshold for this coupon")
+	ErrExcludedProducts         = notApplicable("product_not_eligible", "coupon cannot be applied to one or more products in your cart")
+	ErrInsufficientBuyItems     = notApplicable("insufficient_buy_products", "insufficient buy products for applying BxGy coupon")
+	ErrNoDiscount               = notApplicable("no_discount", "coupon gives no discount on this cart")
+	ErrCustomerNotAllowed       = notApplicable("customer_not_eligible", "coupon is not available for this customer")
+	ErrFirstOrderOnly           = notApplicable("first_order_only", "coupon is only available on a customer's first order")
+	ErrNewCustomersOnly         = notApplicable("new_customers_only", "coupon is only available to new customers")
+	ErrSignupDateRequired       = invalidField("signup_date_required", "cart.customer.signup_date", "customer signup date is required for this coupon")
+	ErrTenantNotFound           = newError(ErrNotFound, "tenant_not_found", "tenant not found")
+	ErrTenantMismatch           = newError(ErrForbidden, "tenant_mismatch", "credentials are not valid for this tenant")
+	ErrCredentialsRequired      = newError(ErrUnauthorized, "credentials_required", "an API key or bearer token is required")
+	ErrInvalidCredentials       = newError(ErrUnauthorized, "invalid_credentials", "invalid API key")
+	ErrInvalidToken             = newError(ErrUnauthorized, "invalid_token", "invalid bearer token")
+	ErrInsufficientScope        = newError(ErrForbidden, "insufficient_scope", "caller is not allowed to perform this action")
+	ErrCustomerMismatch         = newError(ErrForbidden, "customer_mismatch", "cart customer does not match the authenticated customer")
+	ErrRateLimited              = newError(ErrTooManyRequests, "rate_limited", "too many requests; retry later")
+	ErrLockedOut                = newError(ErrTooManyRequests, "locked_out", "too many failed attempts; retry later")
+	ErrImportRejected           = newError(ErrInvalid, "import_rejected", "no coupons were imported because some rows are invalid")
+	ErrNotReady                 = newError(ErrUnavailable, "not_ready", "service is starting up; retry shortly")
+	ErrCodeKeyspaceExhausted    = newError(ErrConflict, "code_keyspace_exhausted", "unable to generate unique codes: keyspace exhausted")
+	ErrInvalidCartWiseThreshold = notApplicable("invalid_coupon_configuration", "invalid threshold value in cart-wise coupon")
+	ErrInvalidCartWiseDiscount  = notApplicable("invalid_coupon_configuration", "invalid discount value in cart-wise coupon")
+	ErrInvalidProductWiseID     = notApplicable("invalid_coupon_configuration", "invalid product ID in product-wise coupon")
+	ErrInvalidProductDiscount   = notApplicable("invalid_coupon_configuration", "invalid discount value in product-wise coupon")
+	ErrInvalidBxGyDetails       = notApplicable("invalid_coupon_configuration", "invalid BxGy coupon details")
+)
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}
+	CreateCoupon(coupon)
+
+	err := CreateCoupon(coupon)
+	if !errors.Is(err, ErrConflict) || !errors.Is(err, ErrCouponExists) {
+		t.Fatalf("Expected conflict error, got %v", err)
+	}
+
+	err = UpdateCoupon("1", models.Coupon{Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 150.0, MaxUses: 5}})
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected invalid error, got %v", err)
+	}
+	if serviceErr.Code != "invalid_discount" || serviceErr.Field != "details.discount" {
+		t.Fatalf("Expected invalid_discount on details.discount, got %s on %s", serviceErr.Code, serviceErr.Field)
+	}
+
+	if _, err := GetCouponByID("2"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 50.0},
+		},
+	}
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); !errors.Is(err, ErrNotApplicable) {
+		t.Fatalf("Expected not applicable error, got %v", err)
+	}
+}
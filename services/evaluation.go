@@ -0,0 +1,110 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EvaluateCoupons prices every coupon of the cart's tenant against the cart without
+// recording any use. Each coupon is evaluated on its own, and coupons that do not apply
+// come back with the reason and, where the cart is close, a hint describing what would
+// make it apply.
+func EvaluateCoupons(cart models.Cart) ([]models.CouponEvaluation, []models.CouponEvaluation, error) {
+	if len(cart.Items) == 0 {
+		return nil, nil, ErrCartEmpty
+	}
+
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	now := time.Now()
+	customer := cartCustomer(cart)
+	currency := cartCurrency(cart)
+	applicable := []models.CouponEvaluation{}
+	rejected := []models.CouponEvaluation{}
+
+	for _, coupon := range Coupons {
+		if coupon.TenantID != cart.TenantID {
+			continue
+		}
+		// Drafts, paused, archived and not-yet-started coupons are never shown to shoppers.
+		if checkCouponActive(coupon, now) != nil {
+			continue
+		}
+
+		evaluation := models.CouponEvaluation{CouponID: coupon.ID, Type: coupon.Type}
+
+		// Coupons redeemed through generated codes are not offered by ID.
+		discount, err := 0.0, error(ErrGeneratedCodeRequired)
+		if !coupon.CodesOnly {
+			discount, _, err = priceCoupon(cart, coupon, customer, make(map[string]bool))
+		}
+		discount = math.Round(discount*100) / 100
+		if err == nil && discount <= 0 {
+			err = ErrNoDiscount
+		}
+		if err != nil {
+			describeRejection(&evaluation, err, currency)
+			rejected = append(rejected, evaluation)
+			continue
+		}
+
+		evaluation.Discount = discount
+		applicable = append(applicable, evaluation)
+	}
+
+	sort.Slice(applicable, func(i, j int) bool {
+		if applicable[i].Discount != applicable[j].Discount {
+			return applicable[i].Discount > applicable[j].Discount
+		}
+		return applicable[i].CouponID < applicable[j].CouponID
+	})
+	sort.Slice(rejected, func(i, j int) bool {
+		return rejected[i].CouponID < rejected[j].CouponID
+	})
+	return applicable, rejected, nil
+}
+
+// cartCurrency is the currency the cart is priced in: its own, once validated, or its
+// tenant's.
+func cartCurrency(cart models.Cart) string {
+	if cart.Currency != "" {
+		return cart.Currency
+	}
+	tenant, err := ResolveTenant(cart.TenantID)
+	if err != nil {
+		return DefaultCurrency
+	}
+	return tenant.Currency
+}
+
+// describeRejection fills in the reason a coupon does not apply. Amounts in hints carry
+// the currency code, e.g. "add 23.50 EUR more".
+func describeRejection(evaluation *models.CouponEvaluation, err error, currency string) {
+	evaluation.Message = err.Error()
+
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) {
+		evaluation.Reason = "internal_error"
+		return
+	}
+	evaluation.Reason = serviceErr.Code
+
+	if shortfall, ok := serviceErr.Details["shortfall"].(float64); ok {
+		evaluation.Shortfall = shortfall
+		evaluation.Hint = fmt.Sprintf("add %.2f %s more", shortfall, currency)
+	}
+	if products, ok := serviceErr.Details["missing_products"].([]models.BuyProduct); ok && len(products) > 0 {
+		evaluation.MissingProducts = products
+		parts := make([]string, 0, len(products))
+		for _, product := range products {
+			parts = append(parts, fmt.Sprintf("%d more %s", product.Quantity, product.ProductID))
+		}
+		evaluation.Hint = "add " + strings.Join(parts, " and ")
+	}
+}
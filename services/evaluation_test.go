@@ -0,0 +1,84 @@
+package services
+
+import (
+	"coupon/models"
+	"testing"
+)
+
+func TestEvaluateCoupons(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+	CreateCoupon(models.Coupon{
+		ID:      "2",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 200.0, Discount: 20.0, MaxUses: 5},
+	})
+	CreateCoupon(models.Coupon{
+		ID:   "3",
+		Type: "bxgy",
+		Details: models.CouponDetails{
+			BuyProducts:     []models.BuyProduct{{ProductID: "A123", Quantity: 3}},
+			GetProducts:     []models.GetProduct{{ProductID: "B456", Quantity: 1}},
+			RepetitionLimit: 1,
+			MaxUses:         5,
+		},
+	})
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 2, Price: 76.25},
+			{ProductID: "B456", Quantity: 1, Price: 24.0},
+		},
+	}
+
+	applicable, rejected, err := EvaluateCoupons(cart)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(applicable) != 1 || applicable[0].CouponID != "1" || applicable[0].Discount != 17.65 {
+		t.Fatalf("Expected coupon 1 to apply with discount 17.65, got %+v", applicable)
+	}
+	if Coupons["1"].Details.Uses != 0 {
+		t.Fatalf("Expected evaluation not to record a use, got %d", Coupons["1"].Details.Uses)
+	}
+
+	if len(rejected) != 2 {
+		t.Fatalf("Expected 2 non-applicable coupons, got %+v", rejected)
+	}
+	if rejected[0].Reason != "below_threshold" || rejected[0].Hint != "add 23.50 USD more" {
+		t.Fatalf("Expected threshold near-miss for coupon 2, got %+v", rejected[0])
+	}
+	if rejected[1].Reason != "insufficient_buy_products" || rejected[1].Hint != "add 1 more A123" {
+		t.Fatalf("Expected BxGy near-miss for coupon 3, got %+v", rejected[1])
+	}
+}
+
+func TestEvaluateCouponsHintCurrency(t *testing.T) {
+	Tenants = map[string]models.Tenant{"acme": {ID: "acme", Currency: "EUR", Timezone: DefaultTimezone}}
+	defer func() { Tenants = nil }()
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	CreateCoupon(models.Coupon{
+		ID:       "1",
+		TenantID: "acme",
+		Type:     "cart-wise",
+		Details:  models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+
+	cart := models.Cart{TenantID: "acme", Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 50.0}}}
+	_, rejected, err := EvaluateCoupons(cart)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rejected) != 1 || rejected[0].Hint != "add 50.00 EUR more" {
+		t.Fatalf("Expected the hint in the tenant's currency, got %+v", rejected)
+	}
+}
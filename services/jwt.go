@@ -0,0 +1,293 @@
+package services
+
+import (
+	"bytes"
+	"coupon/models"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Roles a bearer token can carry.
+const (
+	RoleAdmin      = "admin"
+	RoleMarketer   = "marketer"
+	RoleSupport    = "support"
+	RoleStorefront = "storefront"
+)
+
+// RolePermissions is the permission matrix: the scopes, and so the routes, each role may
+// use. A token with several roles gets the union of their scopes.
+var RolePermissions = map[string][]string{
+	RoleAdmin:      knownScopes,
+	RoleMarketer:   {ScopeCouponsRead, ScopeCouponsWrite, ScopeReportsRead},
+	RoleSupport:    {ScopeCouponsRead, ScopeCustomersRead, ScopeAuditRead, ScopeReportsRead},
+	RoleStorefront: {ScopeCouponsRead, ScopeCartsApply, ScopeOrdersWrite},
+}
+
+// jwtClockSkew is how far exp and nbf may be off before a token is rejected.
+const jwtClockSkew = 30 * time.Second
+
+// BearerTokens authenticates bearer tokens. It is nil when no signing keys are configured.
+var BearerTokens *JWTVerifier
+
+// JWTVerifier checks HS256 and RS256 JSON Web Tokens against locally configured keys
+// and maps their role claim to scopes.
+type JWTVerifier struct {
+	// Audience, when set, must appear in the token's aud claim.
+	Audience string
+	// RolesClaim names the claim holding the caller's roles, as a string or a list.
+	RolesClaim string
+	// TenantClaim names the claim binding the caller to one tenant.
+	TenantClaim string
+	// CustomerClaim names the claim identifying the shopper a token was issued to.
+	CustomerClaim string
+
+	hmacKeys map[string][]byte
+	rsaKeys  map[string]*rsa.PublicKey
+}
+
+func NewJWTVerifier(audience string) *JWTVerifier {
+	return &JWTVerifier{
+		Audience:      audience,
+		RolesClaim:    "roles",
+		TenantClaim:   "tenant",
+		CustomerClaim: "customer_id",
+		hmacKeys:      make(map[string][]byte),
+		rsaKeys:       make(map[string]*rsa.PublicKey),
+	}
+}
+
+// AddHMACKey registers an HS256 secret. kid may be empty for tokens without a key ID.
+func (v *JWTVerifier) AddHMACKey(kid string, secret []byte) {
+	v.hmacKeys[kid] = secret
+}
+
+// AddRSAKey registers an RS256 public key. kid may be empty for tokens without a key ID.
+func (v *JWTVerifier) AddRSAKey(kid string, key *rsa.PublicKey) {
+	v.rsaKeys[kid] = key
+}
+
+// LoadRSAPublicKey registers a PEM-encoded RSA public key (PKIX or PKCS #1) without a key ID.
+func (v *JWTVerifier) LoadRSAPublicKey(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return fmt.Errorf("no PEM block in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		v.AddRSAKey("", key)
+		return nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid public key in %s: %v", path, err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("public key in %s is not an RSA key", path)
+	}
+	v.AddRSAKey("", key)
+	return nil
+}
+
+// LoadJWKS registers the RSA ("kty": "RSA") and HMAC ("kty": "oct") keys of a JSON Web
+// Key Set file. Keys marked for encryption are skipped.
+func (v *JWTVerifier) LoadJWKS(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return fmt.Errorf("invalid JWKS file: %v", err)
+	}
+
+	for _, key := range set.Keys {
+		if key.Use == "enc" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			modulus, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil || len(modulus) == 0 {
+				return fmt.Errorf("JWKS key %q: invalid modulus", key.Kid)
+			}
+			exponent, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil || len(exponent) == 0 || len(exponent) > 4 {
+				return fmt.Errorf("JWKS key %q: invalid exponent", key.Kid)
+			}
+			v.AddRSAKey(key.Kid, &rsa.PublicKey{
+				N: new(big.Int).SetBytes(modulus),
+				E: int(new(big.Int).SetBytes(exponent).Int64()),
+			})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("JWKS key %q: invalid secret", key.Kid)
+			}
+			v.AddHMACKey(key.Kid, secret)
+		default:
+			return fmt.Errorf("JWKS key %q: unsupported key type %q", key.Kid, key.Kty)
+		}
+	}
+	return nil
+}
+
+// Verify checks a compact JWS token's signature, exp, nbf and aud and returns the caller
+// it names, with the scopes granted by its roles.
+func (v *JWTVerifier) Verify(token string, now time.Time) (models.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return models.Principal{}, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		return models.Principal{}, invalidToken("malformed header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return models.Principal{}, invalidToken("malformed signature")
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return models.Principal{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return models.Principal{}, invalidToken("malformed claims")
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return models.Principal{}, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	tenant, _ := claims[v.TenantClaim].(string)
+	customer, _ := claims[v.CustomerClaim].(string)
+	principal := models.Principal{ID: subject, Tenant: tenant, Customer: customer}
+	for _, role := range stringsClaim(claims[v.RolesClaim]) {
+		for _, scope := range RolePermissions[role] {
+			if !containsString(principal.Scopes, scope) {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+	}
+	return principal, nil
+}
+
+// verifySignature picks the key by algorithm as well as key ID, so a token cannot get an
+// RSA public key used as an HMAC secret.
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "HS256":
+		secret, ok := v.hmacKeys[kid]
+		if !ok {
+			return invalidToken("unknown signing key")
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalidToken("invalid signature")
+		}
+	case "RS256":
+		key, ok := v.rsaKeys[kid]
+		if !ok {
+			return invalidToken("unknown signing key")
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return invalidToken("invalid signature")
+		}
+	default:
+		return invalidToken("unsupported algorithm")
+	}
+	return nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	expiry, ok := timeClaim(claims["exp"])
+	if !ok {
+		return invalidToken("missing exp claim")
+	}
+	if !now.Before(expiry.Add(jwtClockSkew)) {
+		return invalidToken("token has expired")
+	}
+	if notBefore, ok := timeClaim(claims["nbf"]); ok && now.Add(jwtClockSkew).Before(notBefore) {
+		return invalidToken("token is not valid yet")
+	}
+	if v.Audience != "" && !containsString(stringsClaim(claims["aud"]), v.Audience) {
+		return invalidToken("token is not intended for this service")
+	}
+	return nil
+}
+
+func decodeTokenSegment(segment string, v interface{}) error {
+	content, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func timeClaim(value interface{}) (time.Time, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// stringsClaim reads a claim that may be a single string or a list of strings.
+func stringsClaim(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func invalidToken(reason string) error {
+	return ErrInvalidToken.withDetails(map[string]interface{}{"reason": reason})
+}
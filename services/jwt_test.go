@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signToken(t *testing.T, header, claims map[string]interface{}, sign func([]byte) []byte) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		content, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(content)
+	}
+	signed := encode(header) + "." + encode(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func hs256(secret []byte) func([]byte) []byte {
+	return func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTVerifier_HS256(t *testing.T) {
+	now := time.Now()
+	secret := []byte("shared-secret")
+	verifier := NewJWTVerifier("coupon-api")
+	verifier.AddHMACKey("", secret)
+
+	header := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		"sub":         "marketing-bot",
+		"aud":         []string{"coupon-api"},
+		"exp":         now.Add(time.Hour).Unix(),
+		"nbf":         now.Add(-time.Minute).Unix(),
+		"roles":       []string{RoleMarketer, "unknown"},
+		"customer_id": "c42",
+	}
+
+	principal, err := verifier.Verify(signToken(t, header, claims, hs256(secret)), now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if principal.ID != "marketing-bot" || principal.Customer != "c42" {
+		t.Fatalf("Expected subject as principal and the customer claim, got %+v", principal)
+	}
+	if Authorize(principal, ScopeCouponsWrite) != nil || Authorize(principal, ScopeCartsApply) == nil {
+		t.Fatalf("Expected marketer scopes, got %v", principal.Scopes)
+	}
+
+	rejected := map[string]func() string{
+		"wrong secret": func() string { return signToken(t, header, claims, hs256([]byte("guess"))) },
+		"alg none": func() string {
+			return signToken(t, map[string]interface{}{"alg": "none"}, claims, func([]byte) []byte { return nil })
+		},
+		"expired": func() string {
+			expired := copyClaims(claims)
+			expired["exp"] = now.Add(-time.Hour).Unix()
+			return signToken(t, header, expired, hs256(secret))
+		},
+		"not yet valid": func() string {
+			early := copyClaims(claims)
+			early["nbf"] = now.Add(time.Hour).Unix()
+			return signToken(t, header, early, hs256(secret))
+		},
+		"other audience": func() string {
+			other := copyClaims(claims)
+			other["aud"] = "billing-api"
+			return signToken(t, header, other, hs256(secret))
+		},
+		"missing exp": func() string {
+			missing := copyClaims(claims)
+			delete(missing, "exp")
+			return signToken(t, header, missing, hs256(secret))
+		},
+		"malformed": func() string { return "not-a-token" },
+	}
+	for name, token := range rejected {
+		if _, err := verifier.Verify(token(), now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected invalid token, got %v", name, err)
+		}
+	}
+}
+
+func TestJWTVerifier_RS256WithJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "gateway-1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+	content, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewJWTVerifier("")
+	if err := verifier.LoadJWKS(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	now := time.Now()
+	rs256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	claims := map[string]interface{}{"sub": "checkout", "exp": now.Add(time.Hour).Unix(), "roles": RoleStorefront}
+
+	token := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "gateway-1"}, claims, rs256)
+	principal, err := verifier.Verify(token, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if Authorize(principal, ScopeCartsApply) != nil || Authorize(principal, ScopeCouponsWrite) == nil {
+		t.Fatalf("Expected storefront scopes, got %v", principal.Scopes)
+	}
+
+	unknownKey := signToken(t, map[string]interface{}{"alg": "RS256", "kid": "gateway-2"}, claims, rs256)
+	if _, err := verifier.Verify(unknownKey, now); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected unknown key ID to be rejected, got %v", err)
+	}
+}
+
+func copyClaims(claims map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(claims))
+	for name, value := range claims {
+		copied[name] = value
+	}
+	return copied
+}
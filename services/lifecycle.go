@@ -0,0 +1,111 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"time"
+)
+
+// couponTransitions is the lifecycle state machine: for each action, the states it may be
+// taken from. Activating or resuming lands in active, or scheduled when the coupon's start
+// date is still in the future.
+var couponTransitions = map[string][]string{
+	"activate": {models.StatusDraft},
+	"pause":    {models.StatusActive, models.StatusScheduled},
+	"resume":   {models.StatusPaused},
+	"archive":  {models.StatusDraft, models.StatusScheduled, models.StatusActive, models.StatusPaused},
+}
+
+// TransitionCoupon moves a coupon through its lifecycle with one of the actions activate,
+// pause, resume or archive.
+func TransitionCoupon(tenant, couponID, action string, expectedVersion int, actor models.Actor) (models.Coupon, error) {
+	allowedFrom, exists := couponTransitions[action]
+	if !exists {
+		return models.Coupon{}, invalidField("invalid_action", "action", fmt.Sprintf("unknown lifecycle action: %s", action))
+	}
+
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	coupon, exists := Coupons[tenantKey(tenant, couponID)]
+	if !exists {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+	if err := checkVersion(coupon, expectedVersion); err != nil {
+		return models.Coupon{}, err
+	}
+
+	now := time.Now()
+	current := effectiveStatus(coupon, now)
+	if !containsString(allowedFrom, current) {
+		return models.Coupon{}, &Error{
+			Kind:    ErrConflict,
+			Code:    "invalid_transition",
+			Message: fmt.Sprintf("cannot %s a coupon that is %s", action, current),
+			Details: map[string]interface{}{"status": current, "action": action},
+		}
+	}
+
+	previous := coupon
+	switch action {
+	case "pause":
+		coupon.Status = models.StatusPaused
+	case "archive":
+		coupon.Status = models.StatusArchived
+	default:
+		coupon.Status = startingStatus(coupon, now)
+	}
+	coupon.Version++
+	coupon.UpdatedAt = now
+	Coupons[couponKey(coupon)] = coupon
+	recordRevision(action, &previous, coupon, actor)
+	return coupon, nil
+}
+
+// initialStatus checks the status a coupon is created with. Coupons are live by default;
+// only draft may be requested explicitly besides active.
+func initialStatus(coupon models.Coupon, now time.Time) (string, error) {
+	switch coupon.Status {
+	case "", models.StatusActive, models.StatusScheduled:
+		return startingStatus(coupon, now), nil
+	case models.StatusDraft:
+		return models.StatusDraft, nil
+	default:
+		return "", invalidField("invalid_status", "status", "new coupons must be draft or active")
+	}
+}
+
+func startingStatus(coupon models.Coupon, now time.Time) string {
+	if coupon.Details.StartDate != nil && now.Before(*coupon.Details.StartDate) {
+		return models.StatusScheduled
+	}
+	return models.StatusActive
+}
+
+// effectiveStatus resolves scheduled coupons whose start date has passed to active.
+// Coupons stored before lifecycle states existed have no status and count as active.
+func effectiveStatus(coupon models.Coupon, now time.Time) string {
+	switch coupon.Status {
+	case "":
+		return models.StatusActive
+	case models.StatusScheduled:
+		return startingStatus(coupon, now)
+	default:
+		return coupon.Status
+	}
+}
+
+func withEffectiveStatus(coupon models.Coupon, now time.Time) models.Coupon {
+	coupon.Status = effectiveStatus(coupon, now)
+	return coupon
+}
+
+func checkCouponActive(coupon models.Coupon, now time.Time) error {
+	if coupon.Details.StartDate != nil && now.Before(*coupon.Details.StartDate) {
+		return ErrCouponNotStarted
+	}
+	if status := effectiveStatus(coupon, now); status != models.StatusActive {
+		return ErrCouponNotActive.withDetails(map[string]interface{}{"status": status})
+	}
+	return nil
+}
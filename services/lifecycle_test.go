@@ -0,0 +1,99 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransitionCoupon(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	CouponCodes = make(map[string]string)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Status:  models.StatusDraft,
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+	}
+
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err == nil || err.Error() != "coupon is not active" {
+		t.Fatalf("Expected draft coupon to be rejected, got %v", err)
+	}
+
+	steps := []struct {
+		action   string
+		expected string
+	}{
+		{"activate", models.StatusActive},
+		{"pause", models.StatusPaused},
+		{"resume", models.StatusActive},
+		{"archive", models.StatusArchived},
+	}
+	for _, step := range steps {
+		coupon, err := TransitionCoupon(DefaultTenant, "1", step.action, AnyVersion, models.Actor{})
+		if err != nil {
+			t.Fatalf("Expected %s to succeed, got %v", step.action, err)
+		}
+		if coupon.Status != step.expected {
+			t.Fatalf("Expected %s after %s, got %s", step.expected, step.action, coupon.Status)
+		}
+		if step.action == "pause" {
+			if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); !errors.Is(err, ErrCouponNotActive) {
+				t.Fatalf("Expected paused coupon to be rejected, got %v", err)
+			}
+		}
+	}
+
+	_, err := TransitionCoupon(DefaultTenant, "1", "resume", AnyVersion, models.Actor{})
+	if !errors.Is(err, ErrConflict) || err.Error() != "cannot resume a coupon that is archived" {
+		t.Fatalf("Expected invalid transition, got %v", err)
+	}
+
+	archived, err := GetCouponByID("1")
+	if err != nil || archived.Status != models.StatusArchived || archived.Version != 5 {
+		t.Fatalf("Expected archived coupon at version 5 to stay retrievable, got %+v, %v", archived, err)
+	}
+}
+
+func TestTransitionCoupon_Scheduled(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	start := time.Now().Add(time.Hour)
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5, StartDate: &start},
+	})
+
+	coupon, _ := GetCouponByID("1")
+	if coupon.Status != models.StatusScheduled {
+		t.Fatalf("Expected coupon with a future start date to be scheduled, got %s", coupon.Status)
+	}
+
+	cart := models.Cart{
+		Items: []models.CartItem{
+			{ProductID: "A123", Quantity: 1, Price: 100.0},
+		},
+	}
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err == nil || err.Error() != "coupon is not active yet" {
+		t.Fatalf("Expected scheduled coupon to be rejected, got %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	coupon = Coupons["1"]
+	coupon.Details.StartDate = &past
+	Coupons["1"] = coupon
+	if effectiveStatus(coupon, time.Now()) != models.StatusActive {
+		t.Fatalf("Expected scheduled coupon to become active once started")
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"bytes"
+	"coupon/models"
+	"encoding/json"
+	"fmt"
+)
+
+// PatchCoupon applies an RFC 7396 JSON merge patch to a coupon: omitted members are left
+// unchanged, null removes a member and objects are merged recursively. The patched coupon
+// is validated like a newly created one and only stored if the coupon is still at
+// expectedVersion.
+func PatchCoupon(tenant, couponID string, patch []byte, expectedVersion int, actor models.Actor) (models.Coupon, error) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	coupon, exists := Coupons[tenantKey(tenant, couponID)]
+	if !exists {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+	if err := checkVersion(coupon, expectedVersion); err != nil {
+		return models.Coupon{}, err
+	}
+
+	var patchDocument interface{}
+	if err := json.Unmarshal(patch, &patchDocument); err != nil {
+		return models.Coupon{}, invalidPatch(err)
+	}
+
+	current, err := json.Marshal(coupon)
+	if err != nil {
+		return models.Coupon{}, err
+	}
+	var document interface{}
+	if err := json.Unmarshal(current, &document); err != nil {
+		return models.Coupon{}, err
+	}
+
+	merged, err := json.Marshal(mergePatch(document, patchDocument))
+	if err != nil {
+		return models.Coupon{}, err
+	}
+
+	var patched models.Coupon
+	decoder := json.NewDecoder(bytes.NewReader(merged))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patched); err != nil {
+		return models.Coupon{}, invalidPatch(err)
+	}
+	if patched.ID != couponID {
+		return models.Coupon{}, ErrCouponIDMismatch
+	}
+
+	return saveCoupon("patch", coupon, patched, actor)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+func invalidPatch(err error) error {
+	return &Error{
+		Kind:    ErrInvalid,
+		Code:    "invalid_patch",
+		Message: fmt.Sprintf("invalid merge patch: %v", err),
+	}
+}
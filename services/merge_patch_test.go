@@ -0,0 +1,62 @@
+package services
+
+import (
+	"coupon/models"
+	"testing"
+	"time"
+)
+
+func TestPatchCoupon(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	expiry := time.Now().Add(24 * time.Hour)
+	coupon := models.Coupon{
+		ID:   "1",
+		Type: "cart-wise",
+		Details: models.CouponDetails{
+			Threshold:        100.0,
+			Discount:         10.0,
+			MaxUses:          5,
+			Exclusive:        true,
+			ExpiryDate:       &expiry,
+			ExcludedProducts: []string{"B456"},
+		},
+	}
+	CreateCoupon(coupon)
+
+	patched, err := PatchCoupon(DefaultTenant, "1", []byte(`{"details": {"discount": 15, "expiry_date": null, "excluded_products": ["C789"]}}`), AnyVersion, models.Actor{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if patched.Type != "cart-wise" || patched.Details.Threshold != 100.0 || !patched.Details.Exclusive {
+		t.Fatalf("Expected omitted fields to stay unchanged, got %+v", patched)
+	}
+	if patched.Details.Discount != 15.0 || patched.Details.ExpiryDate != nil {
+		t.Fatalf("Expected discount 15 and cleared expiry, got %+v", patched.Details)
+	}
+	if len(patched.Details.ExcludedProducts) != 1 || patched.Details.ExcludedProducts[0] != "C789" {
+		t.Fatalf("Expected excluded products to be replaced, got %v", patched.Details.ExcludedProducts)
+	}
+
+	if _, err := PatchCoupon(DefaultTenant, "1", []byte(`{"details": {"exclusive": null}}`), AnyVersion, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if Coupons["1"].Details.Exclusive {
+		t.Fatalf("Expected exclusive to be cleared")
+	}
+
+	_, err = PatchCoupon(DefaultTenant, "1", []byte(`{"details": {"threshold": null}}`), AnyVersion, models.Actor{})
+	if err == nil || err.Error() != "threshold is required for cart-wise coupons" {
+		t.Fatalf("Expected 'threshold is required for cart-wise coupons', got %v", err)
+	}
+
+	_, err = PatchCoupon(DefaultTenant, "1", []byte(`{"detials": {}}`), AnyVersion, models.Actor{})
+	if err == nil || err.Error() != `invalid merge patch: json: unknown field "detials"` {
+		t.Fatalf("Expected unknown field error, got %v", err)
+	}
+
+	if _, err := PatchCoupon(DefaultTenant, "2", []byte(`{}`), AnyVersion, models.Actor{}); err == nil || err.Error() != "coupon not found" {
+		t.Fatalf("Expected 'coupon not found', got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"coupon/metrics"
+	"coupon/models"
+	"errors"
+	"time"
+)
+
+var (
+	applySuccesses = metrics.NewCounterVec(metrics.Default, "coupon_apply_success_total",
+		"Coupons applied to carts, by coupon type.", "coupon_type")
+	applyFailures = metrics.NewCounterVec(metrics.Default, "coupon_apply_failures_total",
+		"Coupon applications that were rejected, by error code and coupon type.", "reason", "coupon_type")
+	discountGranted = metrics.NewCounterVec(metrics.Default, "coupon_discount_amount_total",
+		"Total discount granted by applied coupons, by tenant, currency and coupon type.",
+		"tenant", "currency", "coupon_type")
+
+	_ = metrics.NewGaugeFunc(metrics.Default, "coupon_active_coupons",
+		"Coupons across all tenants that are active and not expired.", func() float64 {
+			return float64(countActiveCoupons(time.Now()))
+		})
+)
+
+// observeApply counts one apply attempt. couponType is empty when the coupon could not be
+// found, and is reported as "unknown". Discounts are split by tenant and currency so
+// amounts in different currencies are never added together.
+func observeApply(couponType string, before, after models.Cart, err error) {
+	if couponType == "" {
+		couponType = "unknown"
+	}
+	if err != nil {
+		reason := "internal_error"
+		var serviceErr *Error
+		if errors.As(err, &serviceErr) {
+			reason = serviceErr.Code
+		}
+		applyFailures.Inc(reason, couponType)
+		return
+	}
+	applySuccesses.Inc(couponType)
+	discountGranted.Add(after.TotalDiscount-before.TotalDiscount, tenantLabel(before.TenantID), cartCurrency(before), couponType)
+}
+
+// tenantLabel names the default tenant "default" so its series carry a non-empty label.
+func tenantLabel(tenant string) string {
+	if tenant == DefaultTenant {
+		return "default"
+	}
+	return tenant
+}
+
+func countActiveCoupons(now time.Time) int {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	active := 0
+	for _, coupon := range Coupons {
+		expired := coupon.Details.ExpiryDate != nil && now.After(*coupon.Details.ExpiryDate)
+		if !expired && effectiveStatus(coupon, now) == models.StatusActive {
+			active++
+		}
+	}
+	return active
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"coupon/metrics"
+	"coupon/models"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestApplyMetrics(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Code:    "SAVE10",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 1},
+	})
+	CreateCoupon(models.Coupon{
+		ID:      "2",
+		Type:    "cart-wise",
+		Status:  models.StatusDraft,
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0},
+	})
+
+	before := scrape(t)
+	cart := models.Cart{Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 150.0}}}
+	if _, err := ApplyCouponByCode(cart, "SAVE10", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ApplyCoupon(cart, "1", make(map[string]bool))
+	ApplyCoupon(cart, "missing", make(map[string]bool))
+	after := scrape(t)
+
+	for series, increase := range map[string]float64{
+		`coupon_apply_success_total{coupon_type="cart-wise"}`:                                   1,
+		`coupon_apply_failures_total{reason="usage_limit_exceeded",coupon_type="cart-wise"}`:    1,
+		`coupon_apply_failures_total{reason="coupon_not_found",coupon_type="unknown"}`:          1,
+		`coupon_discount_amount_total{tenant="default",currency="USD",coupon_type="cart-wise"}`: 15,
+	} {
+		if got := after[series] - before[series]; got != increase {
+			t.Fatalf("Expected %s to increase by %v, got %v", series, increase, got)
+		}
+	}
+	if after["coupon_active_coupons"] != 1 {
+		t.Fatalf("Expected 1 active coupon, got %v", after["coupon_active_coupons"])
+	}
+}
+
+// scrape reads the default registry into a map of series to value.
+func scrape(t *testing.T) map[string]float64 {
+	var output bytes.Buffer
+	if err := metrics.Default.Write(&output); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, line := range strings.Split(output.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		separator := strings.LastIndex(line, " ")
+		var value float64
+		if _, err := fmt.Sscan(line[separator+1:], &value); err != nil {
+			t.Fatalf("Expected a numeric sample, got %q", line)
+		}
+		values[line[:separator]] = value
+	}
+	return values
+}
+
+func TestApplyMetricsByTenantCurrency(t *testing.T) {
+	Tenants = map[string]models.Tenant{"acme": {ID: "acme", Currency: "EUR", Timezone: DefaultTimezone}}
+	defer func() { Tenants = nil }()
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	CreateCoupon(models.Coupon{ID: "1", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5}})
+	CreateCoupon(models.Coupon{ID: "1", TenantID: "acme", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 20.0, MaxUses: 5}})
+
+	before := scrape(t)
+	items := []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 100.0}}
+	if _, err := ApplyCoupon(models.Cart{Items: items}, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := ApplyCoupon(models.Cart{TenantID: "acme", Items: items}, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	after := scrape(t)
+
+	for series, increase := range map[string]float64{
+		`coupon_discount_amount_total{tenant="default",currency="USD",coupon_type="cart-wise"}`: 10,
+		`coupon_discount_amount_total{tenant="acme",currency="EUR",coupon_type="cart-wise"}`:    20,
+	} {
+		if got := after[series] - before[series]; got != increase {
+			t.Fatalf("Expected %s to increase by %v, got %v", series, increase, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bufio"
+	"coupon/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// OrderHistoryProvider supplies each tenant's completed orders to the first-order and
+// win-back rules, and to the redemption reports.
+type OrderHistoryProvider interface {
+	CustomerOrders(tenant, customerID string) ([]models.Order, error)
+	TenantOrders(tenant string) ([]models.Order, error)
+	RecordOrder(order models.Order) error
+}
+
+// OrderHistory is the provider consulted by validateCouponApplication. It defaults to an
+// in-memory store and can be swapped for a file-backed one or an external order service.
+var OrderHistory OrderHistoryProvider = NewInMemoryOrderHistory()
+
+type InMemoryOrderHistory struct {
+	mutex  sync.RWMutex
+	orders map[string][]models.Order
+}
+
+func NewInMemoryOrderHistory() *InMemoryOrderHistory {
+	return &InMemoryOrderHistory{orders: make(map[string][]models.Order)}
+}
+
+func (h *InMemoryOrderHistory) CustomerOrders(tenant, customerID string) ([]models.Order, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	key := tenantKey(tenant, customerID)
+	orders := make([]models.Order, len(h.orders[key]))
+	copy(orders, h.orders[key])
+	return orders, nil
+}
+
+func (h *InMemoryOrderHistory) TenantOrders(tenant string) ([]models.Order, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	orders := []models.Order{}
+	for key, customerOrders := range h.orders {
+		if tenantOfKey(key) == tenant {
+			orders = append(orders, customerOrders...)
+		}
+	}
+	return orders, nil
+}
+
+func (h *InMemoryOrderHistory) RecordOrder(order models.Order) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key := tenantKey(order.TenantID, order.CustomerID)
+	h.orders[key] = append(h.orders[key], order)
+	return nil
+}
+
+// FileOrderHistory keeps orders in memory and appends each recorded order to a JSON lines
+// file, which is replayed when the provider is opened.
+type FileOrderHistory struct {
+	*InMemoryOrderHistory
+	file *os.File
+}
+
+func NewFileOrderHistory(path string) (*FileOrderHistory, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &FileOrderHistory{InMemoryOrderHistory: NewInMemoryOrderHistory(), file: file}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var order models.Order
+		if err := json.Unmarshal(scanner.Bytes(), &order); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid order history entry: %v", err)
+		}
+		history.InMemoryOrderHistory.RecordOrder(order)
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return history, nil
+}
+
+func (h *FileOrderHistory) RecordOrder(order models.Order) error {
+	line, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	key := tenantKey(order.TenantID, order.CustomerID)
+	h.orders[key] = append(h.orders[key], order)
+	return nil
+}
+
+// Close waits for an in-flight write, flushes the file to disk and closes it.
+func (h *FileOrderHistory) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err := h.file.Sync(); err != nil {
+		h.file.Close()
+		return err
+	}
+	return h.file.Close()
+}
+
+// RecordOrder lets the order service push a completed order into the history provider.
+func RecordOrder(order models.Order) error {
+	if order.ID == "" {
+		return invalidField("order_id_required", "id", "order ID is required")
+	}
+	if order.CustomerID == "" {
+		return invalidField("customer_required", "customer_id", "customer ID is required")
+	}
+	if hasControlCharacters(order.ID) {
+		return invalidField("invalid_order_id", "id", "order ID cannot contain control characters")
+	}
+	if hasControlCharacters(order.CustomerID) {
+		return invalidField("invalid_customer_id", "customer_id", "customer ID cannot contain control characters")
+	}
+	if order.CompletedAt.IsZero() {
+		order.CompletedAt = time.Now()
+	}
+	return OrderHistory.RecordOrder(order)
+}
+
+func checkOrderHistory(coupon models.Coupon, customer models.Customer) error {
+	details := coupon.Details
+	if !details.FirstOrderOnly && details.MinDaysSinceLastOrder <= 0 {
+		return nil
+	}
+	if customer.ID == "" {
+		return ErrCustomerRequired
+	}
+
+	orders, err := OrderHistory.CustomerOrders(coupon.TenantID, customer.ID)
+	if err != nil {
+		return fmt.Errorf("unable to check order history: %v", err)
+	}
+
+	if details.FirstOrderOnly && len(orders) > 0 {
+		return ErrFirstOrderOnly
+	}
+	if details.MinDaysSinceLastOrder > 0 {
+		window := time.Duration(details.MinDaysSinceLastOrder) * 24 * time.Hour
+		for _, order := range orders {
+			if time.Since(order.CompletedAt) < window {
+				return notApplicable("recent_order", fmt.Sprintf("coupon is only available to customers with no orders in the last %d days", details.MinDaysSinceLastOrder))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"coupon/models"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckOrderHistory(t *testing.T) {
+	OrderHistory = NewInMemoryOrderHistory()
+
+	firstOrder := models.Coupon{ID: "1", Details: models.CouponDetails{FirstOrderOnly: true}}
+	winBack := models.Coupon{ID: "2", Details: models.CouponDetails{MinDaysSinceLastOrder: 90}}
+	customer := models.Customer{ID: "cust-1"}
+
+	if err := checkOrderHistory(firstOrder, customer); err != nil {
+		t.Fatalf("Expected first order to be eligible, got %v", err)
+	}
+
+	RecordOrder(models.Order{ID: "o-1", CustomerID: "cust-1", CompletedAt: time.Now().Add(-120 * 24 * time.Hour)})
+
+	if err := checkOrderHistory(firstOrder, customer); err == nil || err.Error() != "coupon is only available on a customer's first order" {
+		t.Fatalf("Expected first order rejection, got %v", err)
+	}
+	if err := checkOrderHistory(winBack, customer); err != nil {
+		t.Fatalf("Expected lapsed customer to be eligible, got %v", err)
+	}
+
+	RecordOrder(models.Order{ID: "o-2", CustomerID: "cust-1"})
+
+	if err := checkOrderHistory(winBack, customer); err == nil || err.Error() != "coupon is only available to customers with no orders in the last 90 days" {
+		t.Fatalf("Expected win-back rejection, got %v", err)
+	}
+	if err := checkOrderHistory(winBack, models.Customer{}); err == nil || err.Error() != "customer ID is required for this coupon" {
+		t.Fatalf("Expected 'customer ID is required for this coupon', got %v", err)
+	}
+}
+
+func TestFileOrderHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.jsonl")
+
+	history, err := NewFileOrderHistory(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	history.RecordOrder(models.Order{ID: "o-1", CustomerID: "cust-1", Total: 50.0, CompletedAt: time.Now()})
+	history.Close()
+
+	reopened, err := NewFileOrderHistory(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer reopened.Close()
+
+	orders, _ := reopened.CustomerOrders(DefaultTenant, "cust-1")
+	if len(orders) != 1 || orders[0].ID != "o-1" {
+		t.Fatalf("Expected replayed order o-1, got %v", orders)
+	}
+}
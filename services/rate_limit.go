@@ -0,0 +1,198 @@
+package services
+
+import (
+	"coupon/models"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle buckets and expired lockouts are dropped.
+const rateLimitSweepInterval = time.Minute
+
+// DefaultRateLimits limits the apply endpoints, whose coupon IDs and codes could
+// otherwise be guessed without limit.
+func DefaultRateLimits() models.RateLimitConfig {
+	return models.RateLimitConfig{
+		Routes: map[string]models.RateLimit{
+			"/apply-coupon/{id}": {RequestsPerMinute: 60, Burst: 20},
+			"/apply-code":        {RequestsPerMinute: 60, Burst: 20},
+		},
+		Failures: models.FailureLimit{MaxFailures: 10, WindowSeconds: 600, LockoutSeconds: 900},
+	}
+}
+
+// RateLimits throttles requests per route and client. It is nil when rate limiting is
+// disabled.
+var RateLimits = mustRateLimiter(DefaultRateLimits())
+
+// RateLimiter keeps one token bucket per route and client, and a failure bucket per
+// client that locks the client out when it runs dry.
+type RateLimiter struct {
+	routes   map[string]models.RateLimit
+	failures models.FailureLimit
+
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lockouts  map[string]time.Time
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	perSec   float64
+	updated  time.Time
+}
+
+// LoadRateLimits reads a rate limit file of the form
+// {"routes": {"/apply-code": {"requests_per_minute": 30, "burst": 10}},
+// "failures": {"max_failures": 5, "window_seconds": 600, "lockout_seconds": 900}}.
+// Routes missing from the file are not limited, and omitting failures disables lockouts.
+func LoadRateLimits(path string) (*RateLimiter, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.RateLimitConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid rate limit file: %v", err)
+	}
+	return NewRateLimiter(config)
+}
+
+func NewRateLimiter(config models.RateLimitConfig) (*RateLimiter, error) {
+	for route, limit := range config.Routes {
+		if limit.RequestsPerMinute <= 0 || limit.Burst <= 0 {
+			return nil, fmt.Errorf("rate limit for %s: requests_per_minute and burst must be positive", route)
+		}
+	}
+	failures := config.Failures
+	if failures.MaxFailures < 0 || failures.WindowSeconds < 0 || failures.LockoutSeconds < 0 {
+		return nil, fmt.Errorf("failure limit cannot be negative")
+	}
+	if failures.MaxFailures > 0 && (failures.WindowSeconds == 0 || failures.LockoutSeconds == 0) {
+		return nil, fmt.Errorf("failure limit needs window_seconds and lockout_seconds")
+	}
+
+	return &RateLimiter{
+		routes:   config.Routes,
+		failures: failures,
+		buckets:  make(map[string]*tokenBucket),
+		lockouts: make(map[string]time.Time),
+	}, nil
+}
+
+func mustRateLimiter(config models.RateLimitConfig) *RateLimiter {
+	limiter, err := NewRateLimiter(config)
+	if err != nil {
+		panic(err)
+	}
+	return limiter
+}
+
+// Limited reports whether requests to route are rate limited.
+func (l *RateLimiter) Limited(route string) bool {
+	_, limited := l.routes[route]
+	return limited
+}
+
+// Allow refuses a request when its client is locked out and, on a limited route, takes
+// a token from the client's bucket. The client must be an identity the server
+// established itself, never one taken from the request body. A refused request charges
+// nothing.
+func (l *RateLimiter) Allow(route, client string, now time.Time) (models.RateLimitStatus, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.sweep(now)
+
+	if until, locked := l.lockouts[client]; locked && now.Before(until) {
+		return models.RateLimitStatus{}, ErrLockedOut.withDetails(map[string]interface{}{
+			"retry_after": secondsUntil(now, until),
+		})
+	}
+
+	limit, limited := l.routes[route]
+	if !limited {
+		return models.RateLimitStatus{}, nil
+	}
+
+	bucket := l.bucket(route+"\x00"+client, float64(limit.Burst), limit.RequestsPerMinute/60, now)
+	if bucket.tokens < 1 {
+		return bucketStatus(bucket), ErrRateLimited.withDetails(map[string]interface{}{
+			"retry_after": int(math.Ceil((1 - bucket.tokens) / bucket.perSec)),
+		})
+	}
+	bucket.tokens--
+	return bucketStatus(bucket), nil
+}
+
+// RecordFailure charges a failed lookup or credential check to the client. A client whose
+// failure budget runs out is locked out, so guessing coupon IDs, codes or API keys stops
+// paying off.
+func (l *RateLimiter) RecordFailure(client string, now time.Time) {
+	if l.failures.MaxFailures == 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	capacity := float64(l.failures.MaxFailures)
+	bucket := l.bucket("failures\x00"+client, capacity, capacity/float64(l.failures.WindowSeconds), now)
+	bucket.tokens--
+	if bucket.tokens < 0 {
+		l.lockouts[client] = now.Add(time.Duration(l.failures.LockoutSeconds) * time.Second)
+		bucket.tokens = capacity
+	}
+}
+
+// bucket returns the bucket for id refilled up to now. The caller holds l.mutex.
+func (l *RateLimiter) bucket(id string, capacity, perSec float64, now time.Time) *tokenBucket {
+	bucket, exists := l.buckets[id]
+	if !exists {
+		bucket = &tokenBucket{tokens: capacity, capacity: capacity, perSec: perSec, updated: now}
+		l.buckets[id] = bucket
+	}
+	if elapsed := now.Sub(bucket.updated).Seconds(); elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*perSec)
+		bucket.updated = now
+	}
+	return bucket
+}
+
+// sweep drops buckets that have refilled completely, which behave exactly like new
+// ones, and lockouts that have expired. The caller holds l.mutex.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for id, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.perSec >= bucket.capacity {
+			delete(l.buckets, id)
+		}
+	}
+	for key, until := range l.lockouts {
+		if !now.Before(until) {
+			delete(l.lockouts, key)
+		}
+	}
+}
+
+func bucketStatus(bucket *tokenBucket) models.RateLimitStatus {
+	return models.RateLimitStatus{
+		Limit:      int(bucket.capacity),
+		Remaining:  int(math.Floor(bucket.tokens)),
+		ResetAfter: int(math.Ceil((bucket.capacity - bucket.tokens) / bucket.perSec)),
+	}
+}
+
+func secondsUntil(now, until time.Time) int {
+	return int(math.Ceil(until.Sub(now).Seconds()))
+}
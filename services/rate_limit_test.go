@@ -0,0 +1,103 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter, err := NewRateLimiter(models.RateLimitConfig{
+		Routes: map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 60, Burst: 2}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		status, err := limiter.Allow("/apply-code", "ip:10.0.0.1", now)
+		if err != nil {
+			t.Fatalf("Expected request %d to be allowed, got %v", i+1, err)
+		}
+		if status.Limit != 2 || status.Remaining != 1-i {
+			t.Fatalf("Expected limit 2 and %d remaining, got %+v", 1-i, status)
+		}
+	}
+
+	_, err = limiter.Allow("/apply-code", "ip:10.0.0.1", now)
+	var serviceErr *Error
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &serviceErr) || serviceErr.Details["retry_after"] != 1 {
+		t.Fatalf("Expected rate_limited with retry_after 1, got %v", err)
+	}
+	if _, err := limiter.Allow("/apply-code", "ip:10.0.0.1", now.Add(time.Second)); err != nil {
+		t.Fatalf("Expected a token after one second, got %v", err)
+	}
+	if _, err := limiter.Allow("/apply-code", "ip:10.0.0.2", now); err != nil {
+		t.Fatalf("Expected other clients to have their own bucket, got %v", err)
+	}
+
+	status, err := limiter.Allow("/coupons", "ip:10.0.0.1", now)
+	if err != nil || status.Limit != 0 {
+		t.Fatalf("Expected unlimited route to pass without status, got %+v, %v", status, err)
+	}
+}
+
+func TestRateLimiter_Lockout(t *testing.T) {
+	limiter, _ := NewRateLimiter(models.RateLimitConfig{
+		Routes:   map[string]models.RateLimit{"/apply-coupon/{id}": {RequestsPerMinute: 600, Burst: 100}},
+		Failures: models.FailureLimit{MaxFailures: 2, WindowSeconds: 60, LockoutSeconds: 300},
+	})
+
+	now := time.Now()
+	limiter.RecordFailure("customer:/c1", now)
+	limiter.RecordFailure("customer:/c1", now)
+	if _, err := limiter.Allow("/apply-coupon/{id}", "customer:/c1", now); err != nil {
+		t.Fatalf("Expected failures within the budget to be allowed, got %v", err)
+	}
+
+	limiter.RecordFailure("customer:/c1", now)
+	_, err := limiter.Allow("/apply-coupon/{id}", "customer:/c1", now.Add(time.Minute))
+	var serviceErr *Error
+	if !errors.Is(err, ErrLockedOut) || !errors.As(err, &serviceErr) || serviceErr.Details["retry_after"] != 240 {
+		t.Fatalf("Expected locked_out with retry_after 240, got %v", err)
+	}
+	if _, err := limiter.Allow("/apply-coupon/{id}", "customer:/c2", now); err != nil {
+		t.Fatalf("Expected other clients not to be locked out, got %v", err)
+	}
+	if _, err := limiter.Allow("/coupons", "customer:/c1", now.Add(time.Minute)); !errors.Is(err, ErrLockedOut) {
+		t.Fatalf("Expected the lockout to apply to unlimited routes too, got %v", err)
+	}
+	if _, err := limiter.Allow("/apply-coupon/{id}", "customer:/c1", now.Add(5*time.Minute)); err != nil {
+		t.Fatalf("Expected lockout to expire, got %v", err)
+	}
+}
+
+func TestLoadRateLimits(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rate_limits.json")
+	content := `{"routes": {"/apply-code": {"requests_per_minute": 30, "burst": 10}}}`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := LoadRateLimits(file)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !limiter.Limited("/apply-code") || limiter.Limited("/apply-coupon/{id}") {
+		t.Fatalf("Expected only the configured route to be limited")
+	}
+
+	for name, config := range map[string]models.RateLimitConfig{
+		"zero burst":        {Routes: map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: 10}}},
+		"negative rate":     {Routes: map[string]models.RateLimit{"/apply-code": {RequestsPerMinute: -1, Burst: 1}}},
+		"lockout no window": {Failures: models.FailureLimit{MaxFailures: 5, LockoutSeconds: 60}},
+	} {
+		if _, err := NewRateLimiter(config); err == nil {
+			t.Errorf("%s: expected rate limits to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+
+	DefaultRedemptionLimit = 100
+	MaxRedemptionLimit     = 1000
+	DefaultTopCoupons      = 10
+	MaxTopCoupons          = 100
+)
+
+// Redemptions is the redemption ledger: every coupon use per tenant, oldest first.
+var Redemptions = make(map[string][]models.Redemption)
+
+// recordRedemption appends a use to the ledger. The caller holds couponsMutex.
+func recordRedemption(coupon models.Coupon, code string, priced models.Cart, customerID string, orderValue, discount float64, now time.Time) {
+	snapshot := priced
+	snapshot.Items = append([]models.CartItem(nil), priced.Items...)
+	if priced.Customer != nil {
+		customer := *priced.Customer
+		snapshot.Customer = &customer
+	}
+
+	ledger := Redemptions[coupon.TenantID]
+	Redemptions[coupon.TenantID] = append(ledger, models.Redemption{
+		ID:             len(ledger) + 1,
+		TenantID:       coupon.TenantID,
+		CouponID:       coupon.ID,
+		CouponType:     coupon.Type,
+		CouponRevision: coupon.Version,
+		Code:           code,
+		CustomerID:     customerID,
+		OrderID:        priced.OrderID,
+		Cart:           snapshot,
+		OrderValue:     roundMoney(orderValue),
+		Discount:       discount,
+		RedeemedAt:     now,
+	})
+	couponStoreChanged()
+}
+
+// QueryRedemptions returns the matching ledger entries, newest first.
+func QueryRedemptions(query models.RedemptionQuery) ([]models.Redemption, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultRedemptionLimit
+	}
+	if query.Limit < 0 || query.Limit > MaxRedemptionLimit {
+		return nil, invalidField("invalid_limit", "limit", fmt.Sprintf("limit must be between 1 and %d", MaxRedemptionLimit))
+	}
+	if err := checkRedemptionRange(query); err != nil {
+		return nil, err
+	}
+
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	ledger := Redemptions[query.Tenant]
+	redemptions := []models.Redemption{}
+	for i := len(ledger) - 1; i >= 0 && len(redemptions) < query.Limit; i-- {
+		if redemptionMatches(ledger[i], query) {
+			redemptions = append(redemptions, ledger[i])
+		}
+	}
+	return redemptions, nil
+}
+
+// GetRedemptionReport aggregates the matching redemptions into day or week buckets that
+// start at midnight (Monday for weeks) in the tenant's timezone. Buckets run from the first
+// to the last redemption, with empty ones included so the series has no gaps. Orders
+// placed without a coupon are compared within the same buckets.
+func GetRedemptionReport(query models.RedemptionQuery) (models.RedemptionReport, error) {
+	if query.Interval == "" {
+		query.Interval = IntervalDay
+	}
+	if query.Interval != IntervalDay && query.Interval != IntervalWeek {
+		return models.RedemptionReport{}, invalidField("invalid_interval", "interval", "interval must be day or week")
+	}
+	if err := checkRedemptionRange(query); err != nil {
+		return models.RedemptionReport{}, err
+	}
+	location := TenantLocation(query.Tenant)
+
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	baseline, err := ordersWithoutCoupon(query)
+	if err != nil {
+		return models.RedemptionReport{}, err
+	}
+
+	var totals redemptionTotals
+	buckets := make(map[time.Time]*redemptionTotals)
+	var first, last time.Time
+	for _, redemption := range Redemptions[query.Tenant] {
+		if !redemptionMatches(redemption, query) {
+			continue
+		}
+		start := bucketStart(redemption.RedeemedAt, query.Interval, location)
+		if buckets[start] == nil {
+			buckets[start] = &redemptionTotals{}
+		}
+		buckets[start].add(redemption)
+		totals.add(redemption)
+		if first.IsZero() || start.Before(first) {
+			first = start
+		}
+		if start.After(last) {
+			last = start
+		}
+	}
+
+	report := models.RedemptionReport{Interval: query.Interval, Buckets: []models.RedemptionBucket{}}
+	if first.IsZero() {
+		report.Totals = totals.summary()
+		return report, nil
+	}
+	end := nextBucket(last, query.Interval)
+	for _, order := range baseline {
+		start := bucketStart(order.CompletedAt, query.Interval, location)
+		if start.Before(first) || !start.Before(end) {
+			continue
+		}
+		if buckets[start] == nil {
+			buckets[start] = &redemptionTotals{}
+		}
+		buckets[start].addOrder(order)
+		totals.addOrder(order)
+	}
+
+	report.Totals = totals.summary()
+	for start := first; !start.After(last); start = nextBucket(start, query.Interval) {
+		bucket := models.RedemptionBucket{Start: start}
+		if totals := buckets[start]; totals != nil {
+			bucket.RedemptionSummary = totals.summary()
+		}
+		report.Buckets = append(report.Buckets, bucket)
+	}
+	return report, nil
+}
+
+// GetTopCoupons ranks coupons by their matching redemptions, or by the discount they
+// gave when sortBy is "discount". Every coupon is compared with the same orders placed
+// without a coupon.
+func GetTopCoupons(query models.RedemptionQuery, sortBy string) ([]models.CouponRanking, error) {
+	if query.Limit == 0 {
+		query.Limit = DefaultTopCoupons
+	}
+	if query.Limit < 0 || query.Limit > MaxTopCoupons {
+		return nil, invalidField("invalid_limit", "limit", fmt.Sprintf("limit must be between 1 and %d", MaxTopCoupons))
+	}
+	if sortBy == "" {
+		sortBy = "redemptions"
+	}
+	if sortBy != "redemptions" && sortBy != "discount" {
+		return nil, invalidField("invalid_sort", "sort", "sort must be redemptions or discount")
+	}
+	if err := checkRedemptionRange(query); err != nil {
+		return nil, err
+	}
+
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	baseline, err := ordersWithoutCoupon(query)
+	if err != nil {
+		return nil, err
+	}
+	var withoutCoupon redemptionTotals
+	for _, order := range baseline {
+		withoutCoupon.addOrder(order)
+	}
+
+	totals := make(map[string]*redemptionTotals)
+	types := make(map[string]string)
+	for _, redemption := range Redemptions[query.Tenant] {
+		if !redemptionMatches(redemption, query) {
+			continue
+		}
+		if totals[redemption.CouponID] == nil {
+			couponTotals := withoutCoupon
+			totals[redemption.CouponID] = &couponTotals
+		}
+		totals[redemption.CouponID].add(redemption)
+		types[redemption.CouponID] = redemption.CouponType
+	}
+
+	rankings := make([]models.CouponRanking, 0, len(totals))
+	for couponID, couponTotals := range totals {
+		rankings = append(rankings, models.CouponRanking{
+			CouponID:          couponID,
+			CouponType:        types[couponID],
+			RedemptionSummary: couponTotals.summary(),
+		})
+	}
+	sort.Slice(rankings, func(i, j int) bool {
+		a, b := rankings[i], rankings[j]
+		if sortBy == "discount" && a.TotalDiscount != b.TotalDiscount {
+			return a.TotalDiscount > b.TotalDiscount
+		}
+		if a.Redemptions != b.Redemptions {
+			return a.Redemptions > b.Redemptions
+		}
+		return a.CouponID < b.CouponID
+	})
+	if len(rankings) > query.Limit {
+		rankings = rankings[:query.Limit]
+	}
+	return rankings, nil
+}
+
+type redemptionTotals struct {
+	count      int
+	discount   float64
+	orderValue float64
+	orders     int
+	orderTotal float64
+}
+
+func (t *redemptionTotals) add(redemption models.Redemption) {
+	t.count++
+	t.discount += redemption.Discount
+	t.orderValue += redemption.OrderValue
+}
+
+// addOrder counts an order placed without a coupon.
+func (t *redemptionTotals) addOrder(order models.Order) {
+	t.orders++
+	t.orderTotal += order.Total
+}
+
+func (t *redemptionTotals) summary() models.RedemptionSummary {
+	summary := models.RedemptionSummary{Redemptions: t.count, TotalDiscount: roundMoney(t.discount), OrdersWithoutCoupon: t.orders}
+	if t.count > 0 {
+		summary.AverageOrderValueWithCoupon = roundMoney((t.orderValue - t.discount) / float64(t.count))
+	}
+	if t.orders > 0 {
+		summary.AverageOrderValueWithoutCoupon = roundMoney(t.orderTotal / float64(t.orders))
+	}
+	return summary
+}
+
+// ordersWithoutCoupon returns the tenant's completed orders matching the query that no
+// redemption in the ledger names, so coupon orders are only counted once. Orders are
+// matched to redemptions by the order_id sent in the cart. The caller holds couponsMutex.
+func ordersWithoutCoupon(query models.RedemptionQuery) ([]models.Order, error) {
+	orders, err := OrderHistory.TenantOrders(query.Tenant)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read order history: %v", err)
+	}
+
+	redeemed := make(map[string]bool)
+	for _, redemption := range Redemptions[query.Tenant] {
+		if redemption.OrderID != "" {
+			redeemed[redemption.OrderID] = true
+		}
+	}
+	var baseline []models.Order
+	for _, order := range orders {
+		if !redeemed[order.ID] && orderMatches(order, query) {
+			baseline = append(baseline, order)
+		}
+	}
+	return baseline, nil
+}
+
+func orderMatches(order models.Order, query models.RedemptionQuery) bool {
+	if query.CustomerID != "" && order.CustomerID != query.CustomerID {
+		return false
+	}
+	if query.OrderID != "" && order.ID != query.OrderID {
+		return false
+	}
+	if query.Since != nil && order.CompletedAt.Before(*query.Since) {
+		return false
+	}
+	if query.Until != nil && !order.CompletedAt.Before(*query.Until) {
+		return false
+	}
+	return true
+}
+
+func redemptionMatches(redemption models.Redemption, query models.RedemptionQuery) bool {
+	if query.CouponID != "" && redemption.CouponID != query.CouponID {
+		return false
+	}
+	if query.CustomerID != "" && redemption.CustomerID != query.CustomerID {
+		return false
+	}
+	if query.OrderID != "" && redemption.OrderID != query.OrderID {
+		return false
+	}
+	if query.Since != nil && redemption.RedeemedAt.Before(*query.Since) {
+		return false
+	}
+	if query.Until != nil && !redemption.RedeemedAt.Before(*query.Until) {
+		return false
+	}
+	return true
+}
+
+func checkRedemptionRange(query models.RedemptionQuery) error {
+	if query.Since != nil && query.Until != nil && query.Until.Before(*query.Since) {
+		return invalidField("invalid_range", "until", "until must not be before since")
+	}
+	return nil
+}
+
+func bucketStart(t time.Time, interval string, location *time.Location) time.Time {
+	local := t.In(location)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	if interval == IntervalWeek {
+		daysSinceMonday := (int(start.Weekday()) + 6) % 7
+		start = start.AddDate(0, 0, -daysSinceMonday)
+	}
+	return start
+}
+
+func nextBucket(start time.Time, interval string) time.Time {
+	if interval == IntervalWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
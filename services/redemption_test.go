@@ -0,0 +1,153 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRedemptionLedger(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	Redemptions = make(map[string][]models.Redemption)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Code:    "SAVE10",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+
+	cart := models.Cart{
+		OrderID:    "order-1",
+		CustomerID: "c1",
+		Items:      []models.CartItem{{ProductID: "A123", Quantity: 2, Price: 75.0}},
+	}
+	if _, err := ApplyCouponByCode(cart, "save10", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cart.OrderID = "order-2"
+	cart.CustomerID = "c2"
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	ApplyCoupon(cart, "missing", make(map[string]bool))
+
+	redemptions, err := QueryRedemptions(models.RedemptionQuery{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(redemptions) != 2 {
+		t.Fatalf("Expected 2 redemptions, got %d", len(redemptions))
+	}
+	first := redemptions[1]
+	if first.ID != 1 || first.Code != "SAVE10" || first.OrderID != "order-1" || first.CustomerID != "c1" {
+		t.Fatalf("Expected the code, order and customer to be recorded, got %+v", first)
+	}
+	if first.OrderValue != 150.0 || first.Discount != 15.0 || first.Cart.FinalPrice != 135.0 || first.CouponRevision != 1 {
+		t.Fatalf("Expected the priced cart to be recorded, got %+v", first)
+	}
+	if redemptions[0].Code != "" || redemptions[0].OrderID != "order-2" {
+		t.Fatalf("Expected newest redemption first without a code, got %+v", redemptions[0])
+	}
+
+	filtered, _ := QueryRedemptions(models.RedemptionQuery{CustomerID: "c2"})
+	if len(filtered) != 1 || filtered[0].ID != 2 {
+		t.Fatalf("Expected customer filter to match redemption 2, got %+v", filtered)
+	}
+	if other, _ := QueryRedemptions(models.RedemptionQuery{Tenant: "acme"}); other == nil || len(other) != 0 {
+		t.Fatalf("Expected other tenants to see an empty ledger, got %+v", other)
+	}
+	if _, err := QueryRedemptions(models.RedemptionQuery{Limit: MaxRedemptionLimit + 1}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected invalid limit, got %v", err)
+	}
+}
+
+func TestGetRedemptionReport(t *testing.T) {
+	Tenants = map[string]models.Tenant{
+		DefaultTenant: {Currency: DefaultCurrency, Timezone: DefaultTimezone},
+		"acme":        {ID: "acme", Currency: "USD", Timezone: "America/New_York"},
+	}
+	defer func() { Tenants = nil }()
+
+	day := func(date string, hour int) time.Time {
+		parsed, _ := time.Parse("2006-01-02", date)
+		return parsed.Add(time.Duration(hour) * time.Hour)
+	}
+	Redemptions = map[string][]models.Redemption{"acme": {
+		// 02:00 UTC on Tuesday 2 July is still Monday 1 July in New York.
+		{CouponID: "A", OrderID: "o1", OrderValue: 100, Discount: 10, RedeemedAt: day("2024-07-02", 2)},
+		{CouponID: "B", OrderValue: 200, Discount: 50, RedeemedAt: day("2024-07-02", 15)},
+		{CouponID: "A", OrderValue: 60, Discount: 6, RedeemedAt: day("2024-07-04", 15)},
+		{CouponID: "A", OrderValue: 80, Discount: 8, RedeemedAt: day("2024-07-09", 15)},
+	}}
+
+	history := OrderHistory
+	OrderHistory = NewInMemoryOrderHistory()
+	defer func() { OrderHistory = history }()
+	for _, order := range []models.Order{
+		{ID: "o1", TenantID: "acme", CustomerID: "c1", Total: 90, CompletedAt: day("2024-07-02", 2)},
+		{ID: "o2", TenantID: "acme", CustomerID: "c2", Total: 120, CompletedAt: day("2024-07-02", 15)},
+		{ID: "o3", TenantID: "acme", CustomerID: "c1", Total: 80, CompletedAt: day("2024-07-05", 15)},
+		{ID: "o4", TenantID: "acme", CustomerID: "c3", Total: 160, CompletedAt: day("2024-08-01", 15)},
+		{ID: "o5", CustomerID: "c1", Total: 500, CompletedAt: day("2024-07-02", 15)},
+	} {
+		RecordOrder(order)
+	}
+
+	report, err := GetRedemptionReport(models.RedemptionQuery{Tenant: "acme"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(report.Buckets) != 9 || report.Interval != IntervalDay {
+		t.Fatalf("Expected 9 daily buckets from 1 to 9 July, got %d", len(report.Buckets))
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+	if !report.Buckets[0].Start.Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, newYork)) || report.Buckets[0].Redemptions != 1 {
+		t.Fatalf("Expected the first bucket to be 1 July in New York, got %+v", report.Buckets[0])
+	}
+	if report.Buckets[2].Redemptions != 0 || report.Buckets[3].Redemptions != 1 {
+		t.Fatalf("Expected an empty bucket for 3 July, got %+v", report.Buckets[2:4])
+	}
+	if report.Buckets[1].OrdersWithoutCoupon != 1 || report.Buckets[1].AverageOrderValueWithoutCoupon != 120 {
+		t.Fatalf("Expected order o2 in the 2 July bucket, got %+v", report.Buckets[1])
+	}
+	// o1 used coupon A, o4 falls after the last bucket and o5 belongs to another tenant.
+	expected := models.RedemptionSummary{Redemptions: 4, TotalDiscount: 74, AverageOrderValueWithCoupon: 91.5, OrdersWithoutCoupon: 2, AverageOrderValueWithoutCoupon: 100}
+	if report.Totals != expected {
+		t.Fatalf("Expected totals %+v, got %+v", expected, report.Totals)
+	}
+
+	since := day("2024-07-02", 12)
+	weekly, err := GetRedemptionReport(models.RedemptionQuery{Tenant: "acme", Interval: IntervalWeek, CouponID: "A", Since: &since})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(weekly.Buckets) != 2 || weekly.Buckets[0].Redemptions != 1 || weekly.Buckets[1].Redemptions != 1 {
+		t.Fatalf("Expected two weekly buckets with one redemption each, got %+v", weekly.Buckets)
+	}
+	if weekly.Buckets[1].Start.Weekday() != time.Monday {
+		t.Fatalf("Expected weeks to start on Monday, got %s", weekly.Buckets[1].Start.Weekday())
+	}
+
+	if _, err := GetRedemptionReport(models.RedemptionQuery{Tenant: "acme", Interval: "month"}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected invalid interval, got %v", err)
+	}
+
+	top, err := GetTopCoupons(models.RedemptionQuery{Tenant: "acme"}, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(top) != 2 || top[0].CouponID != "A" || top[0].Redemptions != 3 || top[0].TotalDiscount != 24 {
+		t.Fatalf("Expected coupon A to rank first by redemptions, got %+v", top)
+	}
+	if top[1].OrdersWithoutCoupon != 3 || top[1].AverageOrderValueWithoutCoupon != 120 {
+		t.Fatalf("Expected every coupon to be compared with orders o2 to o4, got %+v", top[1])
+	}
+	byDiscount, _ := GetTopCoupons(models.RedemptionQuery{Tenant: "acme", Limit: 1}, "discount")
+	if len(byDiscount) != 1 || byDiscount[0].CouponID != "B" {
+		t.Fatalf("Expected coupon B to rank first by discount, got %+v", byDiscount)
+	}
+}
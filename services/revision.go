@@ -0,0 +1,159 @@
+package services
+
+import (
+	"coupon/models"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CouponRevisions holds every stored definition of each coupon, oldest first, keyed by
+// tenant-scoped coupon ID. Revisions are numbered by the coupon version they produced and
+// are never modified or removed, including when the coupon itself is deleted.
+var CouponRevisions = make(map[string][]models.CouponRevision)
+
+// revisionIgnoredFields are maintained by the service rather than by whoever changed the
+// coupon, so they are left out of revision diffs.
+var revisionIgnoredFields = map[string]bool{
+	"version":      true,
+	"created_at":   true,
+	"updated_at":   true,
+	"details.uses": true,
+}
+
+// recordRevision appends the revision produced by an action and audits it. previous is
+// nil when the coupon was just created. Callers must hold couponsMutex.
+func recordRevision(action string, previous *models.Coupon, coupon models.Coupon, actor models.Actor) {
+	var before models.Coupon
+	var auditBefore, auditAfter interface{}
+	if previous != nil {
+		before = *previous
+		auditBefore = before
+	}
+	if action != "delete" {
+		auditAfter = coupon
+	}
+	recordAudit(coupon.TenantID, action, coupon.ID, actor, auditBefore, auditAfter)
+	couponStoreChanged()
+
+	key := couponKey(coupon)
+	CouponRevisions[key] = append(CouponRevisions[key], models.CouponRevision{
+		CouponID:  coupon.ID,
+		Revision:  coupon.Version,
+		Action:    action,
+		Actor:     actor,
+		CreatedAt: coupon.UpdatedAt,
+		Coupon:    coupon,
+		Diff:      diffCoupons(before, coupon),
+	})
+}
+
+func lastRevision(key string) int {
+	revisions := CouponRevisions[key]
+	if len(revisions) == 0 {
+		return 0
+	}
+	return revisions[len(revisions)-1].Revision
+}
+
+// GetCouponRevisions returns the revision history of a coupon, oldest first. The history
+// of a deleted coupon is still available.
+func GetCouponRevisions(tenant, couponID string) ([]models.CouponRevision, error) {
+	couponsMutex.RLock()
+	defer couponsMutex.RUnlock()
+
+	revisions, exists := CouponRevisions[tenantKey(tenant, couponID)]
+	if !exists {
+		return nil, ErrCouponNotFound
+	}
+	return append([]models.CouponRevision(nil), revisions...), nil
+}
+
+// RollbackCoupon restores the definition a coupon had at an earlier revision, provided
+// the coupon is still at expectedVersion. The rollback is itself stored as a new revision;
+// the usage counter and lifecycle status are kept as they are now.
+func RollbackCoupon(tenant, couponID string, revision, expectedVersion int, actor models.Actor) (models.Coupon, error) {
+	couponsMutex.Lock()
+	defer couponsMutex.Unlock()
+
+	coupon, exists := Coupons[tenantKey(tenant, couponID)]
+	if !exists {
+		return models.Coupon{}, ErrCouponNotFound
+	}
+	if err := checkVersion(coupon, expectedVersion); err != nil {
+		return models.Coupon{}, err
+	}
+
+	for _, stored := range CouponRevisions[couponKey(coupon)] {
+		if stored.Revision == revision && stored.Action != "delete" {
+			return saveCoupon("rollback", coupon, stored.Coupon, actor)
+		}
+	}
+	return models.Coupon{}, &Error{
+		Kind:    ErrNotFound,
+		Code:    "revision_not_found",
+		Field:   "revision",
+		Message: fmt.Sprintf("coupon has no revision %d", revision),
+	}
+}
+
+// diffCoupons lists the fields that differ between two definitions, addressed by their
+// dotted JSON path. Lists are compared as a whole.
+func diffCoupons(before, after models.Coupon) []models.FieldChange {
+	beforeFields, afterFields := flattenCoupon(before), flattenCoupon(after)
+
+	fields := make([]string, 0, len(afterFields))
+	for field := range afterFields {
+		fields = append(fields, field)
+	}
+	for field := range beforeFields {
+		if _, exists := afterFields[field]; !exists {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []models.FieldChange
+	for _, field := range fields {
+		if revisionIgnoredFields[field] || reflect.DeepEqual(beforeFields[field], afterFields[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{
+			Field:  field,
+			Before: beforeFields[field],
+			After:  afterFields[field],
+		})
+	}
+	return changes
+}
+
+func flattenCoupon(coupon models.Coupon) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if coupon.ID == "" {
+		return fields
+	}
+
+	encoded, err := json.Marshal(coupon)
+	if err != nil {
+		return fields
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(encoded, &document); err != nil {
+		return fields
+	}
+	flattenInto(fields, nil, document)
+	return fields
+}
+
+func flattenInto(fields map[string]interface{}, path []string, value interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		fields[strings.Join(path, ".")] = value
+		return
+	}
+	for name, member := range object {
+		flattenInto(fields, append(path[:len(path):len(path)], name), member)
+	}
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+)
+
+func TestCouponRevisions(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	admin := models.Actor{ID: "admin", IP: "10.0.0.1"}
+	CreateCouponAs(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}, admin)
+
+	if _, err := PatchCoupon(DefaultTenant, "1", []byte(`{"details": {"discount": 15}}`), AnyVersion, admin); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := TransitionCoupon(DefaultTenant, "1", "pause", AnyVersion, models.Actor{ID: "ops"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	revisions, err := GetCouponRevisions(DefaultTenant, "1")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(revisions) != 3 {
+		t.Fatalf("Expected 3 revisions, got %d", len(revisions))
+	}
+	for i, action := range []string{"create", "patch", "pause"} {
+		if revisions[i].Action != action || revisions[i].Revision != i+1 {
+			t.Fatalf("Expected revision %d to be %s, got %d %s", i+1, action, revisions[i].Revision, revisions[i].Action)
+		}
+	}
+	if revisions[0].Actor.ID != "admin" || revisions[2].Actor.ID != "ops" {
+		t.Fatalf("Expected actors to be recorded, got %+v and %+v", revisions[0].Actor, revisions[2].Actor)
+	}
+
+	diff := revisions[1].Diff
+	if len(diff) != 1 || diff[0].Field != "details.discount" || diff[0].Before != 10.0 || diff[0].After != 15.0 {
+		t.Fatalf("Expected discount change in diff, got %+v", diff)
+	}
+	if diff := revisions[2].Diff; len(diff) != 1 || diff[0].Field != "status" {
+		t.Fatalf("Expected status change in diff, got %+v", diff)
+	}
+}
+
+func TestRollbackCoupon(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	CreateCoupon(models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	})
+	if _, err := PatchCoupon(DefaultTenant, "1", []byte(`{"details": {"discount": 15}}`), AnyVersion, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	cart := models.Cart{
+		CustomerID: "cust-1",
+		Items:      []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 150.0}},
+	}
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := RollbackCoupon(DefaultTenant, "1", 1, 1, models.Actor{}); !errors.Is(err, ErrPrecondition) {
+		t.Fatalf("Expected precondition error for stale version, got %v", err)
+	}
+	if _, err := RollbackCoupon(DefaultTenant, "1", 7, AnyVersion, models.Actor{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected unknown revision to be rejected, got %v", err)
+	}
+
+	restored, err := RollbackCoupon(DefaultTenant, "1", 1, 2, models.Actor{ID: "admin"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if restored.Details.Discount != 10.0 || restored.Version != 3 || restored.Details.Uses != 1 {
+		t.Fatalf("Expected discount 10 at version 3 with uses kept, got %+v", restored)
+	}
+
+	revisions, _ := GetCouponRevisions(DefaultTenant, "1")
+	if last := revisions[len(revisions)-1]; last.Action != "rollback" || last.Revision != 3 {
+		t.Fatalf("Expected rollback revision 3, got %d %s", last.Revision, last.Action)
+	}
+
+	redemptions := GetCustomerRedemptions(DefaultTenant, "cust-1")
+	if len(redemptions) == 0 || redemptions[len(redemptions)-1].CouponRevision != 2 {
+		t.Fatalf("Expected redemption to record revision 2, got %+v", redemptions)
+	}
+}
+
+func TestDeletedCouponKeepsRevisions(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	coupon := models.Coupon{
+		ID:      "1",
+		Type:    "cart-wise",
+		Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 5},
+	}
+	CreateCoupon(coupon)
+	if err := DeleteCoupon("1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	revisions, err := GetCouponRevisions(DefaultTenant, "1")
+	if err != nil || len(revisions) != 2 || revisions[1].Action != "delete" {
+		t.Fatalf("Expected create and delete revisions, got %+v, %v", revisions, err)
+	}
+
+	CreateCoupon(coupon)
+	if Coupons["1"].Version != 3 {
+		t.Fatalf("Expected re-created coupon to continue at version 3, got %d", Coupons["1"].Version)
+	}
+
+	if _, err := GetCouponRevisions(DefaultTenant, "2"); !errors.Is(err, ErrCouponNotFound) {
+		t.Fatalf("Expected coupon not found, got %v", err)
+	}
+}
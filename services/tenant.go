@@ -0,0 +1,128 @@
+package services
+
+import (
+	"coupon/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultTenant is the tenant of requests that do not name one. Its keys are stored
+// unprefixed, so single-tenant deployments keep their data exactly as before.
+const DefaultTenant = ""
+
+const (
+	DefaultCurrency = "USD"
+	DefaultTimezone = "UTC"
+)
+
+var (
+	tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// Tenants holds the configured tenants and their defaults. When it is nil any well-formed
+// tenant ID is accepted and gets the default currency and timezone.
+var Tenants map[string]models.Tenant
+
+// tenantKey scopes a coupon ID, code or customer ID to a tenant. Every store keyed by one
+// of those uses it, so equal IDs in different tenants never collide. Tenant IDs cannot
+// contain NUL, so the tenant is everything before the first one; a default-tenant key
+// that contains NUL itself gets a leading one, so it can never read as another tenant's.
+func tenantKey(tenant, key string) string {
+	if tenant == DefaultTenant {
+		if strings.Contains(key, "\x00") {
+			return "\x00" + key
+		}
+		return key
+	}
+	return tenant + "\x00" + key
+}
+
+// hasControlCharacters reports whether an ID or code contains control characters, which
+// are rejected wherever a client names one.
+func hasControlCharacters(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
+
+func couponKey(coupon models.Coupon) string {
+	return tenantKey(coupon.TenantID, coupon.ID)
+}
+
+// LoadTenants reads a tenant file of the form
+// {"tenants": [{"id": "acme", "currency": "EUR", "timezone": "Europe/Berlin"}]}.
+func LoadTenants(path string) (map[string]models.Tenant, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.TenantConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("invalid tenant file: %v", err)
+	}
+
+	tenants := make(map[string]models.Tenant)
+	for _, tenant := range config.Tenants {
+		if !tenantIDPattern.MatchString(tenant.ID) {
+			return nil, fmt.Errorf("invalid tenant id %q", tenant.ID)
+		}
+		if _, exists := tenants[tenant.ID]; exists {
+			return nil, fmt.Errorf("duplicate tenant id %q", tenant.ID)
+		}
+		tenant = withTenantDefaults(tenant)
+		if !currencyPattern.MatchString(tenant.Currency) {
+			return nil, fmt.Errorf("tenant %q: currency must be an ISO 4217 code", tenant.ID)
+		}
+		if _, err := time.LoadLocation(tenant.Timezone); err != nil {
+			return nil, fmt.Errorf("tenant %q: %v", tenant.ID, err)
+		}
+		tenants[tenant.ID] = tenant
+	}
+	return tenants, nil
+}
+
+// ResolveTenant checks a tenant ID taken from a request and returns its settings.
+func ResolveTenant(tenantID string) (models.Tenant, error) {
+	if tenantID == DefaultTenant {
+		return withTenantDefaults(models.Tenant{ID: DefaultTenant}), nil
+	}
+	if !tenantIDPattern.MatchString(tenantID) {
+		return models.Tenant{}, invalidField("invalid_tenant", "X-Tenant-ID", "tenant ID must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if Tenants == nil {
+		return withTenantDefaults(models.Tenant{ID: tenantID}), nil
+	}
+	tenant, exists := Tenants[tenantID]
+	if !exists {
+		return models.Tenant{}, ErrTenantNotFound
+	}
+	return tenant, nil
+}
+
+// TenantLocation is the timezone date-only values are interpreted in for a tenant.
+func TenantLocation(tenantID string) *time.Location {
+	tenant, err := ResolveTenant(tenantID)
+	if err != nil {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(tenant.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func withTenantDefaults(tenant models.Tenant) models.Tenant {
+	if tenant.Currency == "" {
+		tenant.Currency = DefaultCurrency
+	}
+	if tenant.Timezone == "" {
+		tenant.Timezone = DefaultTimezone
+	}
+	return tenant
+}
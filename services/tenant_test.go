@@ -0,0 +1,158 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTenantIsolation(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+	Redemptions = make(map[string][]models.Redemption)
+	Audit = NewAuditLog()
+
+	for tenant, discount := range map[string]float64{"acme": 10.0, "globex": 20.0} {
+		err := CreateCouponAs(models.Coupon{
+			ID:       "1",
+			TenantID: tenant,
+			Code:     "WELCOME",
+			Type:     "cart-wise",
+			Details:  models.CouponDetails{Threshold: 100.0, Discount: discount, MaxUses: 1},
+		}, models.Actor{})
+		if err != nil {
+			t.Fatalf("Expected equal IDs and codes in different tenants, got %v", err)
+		}
+	}
+
+	if _, err := GetCouponByID("1"); !errors.Is(err, ErrCouponNotFound) {
+		t.Fatalf("Expected tenant coupons to be hidden from the default tenant, got %v", err)
+	}
+	acme, err := GetTenantCoupon("acme", "1")
+	if err != nil || acme.Details.Discount != 10.0 {
+		t.Fatalf("Expected acme coupon, got %+v, %v", acme, err)
+	}
+
+	cart := models.Cart{
+		TenantID:   "globex",
+		CustomerID: "cust-1",
+		Items:      []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 200.0}},
+	}
+	updated, err := ApplyCouponByCode(cart, "welcome", make(map[string]bool))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated.TotalDiscount != 40.0 {
+		t.Fatalf("Expected globex coupon's discount of 40, got %f", updated.TotalDiscount)
+	}
+
+	cart.TenantID = "acme"
+	if _, err := ApplyCoupon(cart, "1", make(map[string]bool)); err != nil {
+		t.Fatalf("Expected acme usage limit to be independent of globex, got %v", err)
+	}
+	if len(GetCustomerRedemptions("globex", "cust-1")) != 1 || len(GetCustomerRedemptions(DefaultTenant, "cust-1")) != 0 {
+		t.Fatalf("Expected redemptions to be recorded per tenant")
+	}
+
+	page, err := ListCoupons(models.CouponQuery{Tenant: "acme"})
+	if err != nil || len(page.Coupons) != 1 || page.Coupons[0].Details.Discount != 10.0 {
+		t.Fatalf("Expected only the acme coupon to be listed, got %+v, %v", page.Coupons, err)
+	}
+	entries, _ := QueryAudit(models.AuditQuery{Tenant: "globex"})
+	if len(entries) != 2 {
+		t.Fatalf("Expected globex create and apply audit entries, got %d", len(entries))
+	}
+
+	if _, err := TransitionCoupon("acme", "1", "archive", AnyVersion, models.Actor{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if coupon, err := GetTenantCoupon("globex", "1"); err != nil || coupon.Status != models.StatusActive {
+		t.Fatalf("Expected globex coupon to stay active after the acme archive, got %+v, %v", coupon, err)
+	}
+}
+
+func TestTenantKeysCannotBeForged(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+	CouponRevisions = make(map[string][]models.CouponRevision)
+
+	err := CreateCoupon(models.Coupon{ID: "acme\x00SAVE", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 90.0, MaxUses: 1}})
+	if err == nil || err.Error() != "coupon ID cannot contain control characters" {
+		t.Fatalf("Expected control characters in IDs to be rejected, got %v", err)
+	}
+	err = CreateCoupon(models.Coupon{ID: "1", Code: "acme\x00SAVE", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 90.0, MaxUses: 1}})
+	if err == nil || err.Error() != "coupon codes cannot contain control characters" {
+		t.Fatalf("Expected control characters in codes to be rejected, got %v", err)
+	}
+
+	// Lookups from the default tenant cannot reach another tenant's keys either.
+	CreateCoupon(models.Coupon{ID: "SAVE", TenantID: "acme", Type: "cart-wise", Details: models.CouponDetails{Threshold: 100.0, Discount: 10.0, MaxUses: 1}})
+	if _, err := GetTenantCoupon(DefaultTenant, "acme\x00SAVE"); !errors.Is(err, ErrCouponNotFound) {
+		t.Fatalf("Expected a forged key not to find acme's coupon, got %v", err)
+	}
+	if tenant := tenantOfKey(tenantKey(DefaultTenant, "acme\x00SAVE")); tenant != DefaultTenant {
+		t.Fatalf("Expected a default-tenant key to stay in the default tenant, got %q", tenant)
+	}
+
+	cart := models.Cart{CustomerID: "acme\x00c1", Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 100.0}}}
+	if _, _, err := ValidateCart(cart, false); err == nil || err.Error() != "customer ID cannot contain control characters" {
+		t.Fatalf("Expected control characters in customer IDs to be rejected, got %v", err)
+	}
+	if err := RecordOrder(models.Order{ID: "o1", CustomerID: "acme\x00c1"}); err == nil {
+		t.Fatalf("Expected control characters in order customer IDs to be rejected")
+	}
+}
+
+func TestTenantDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	config := `{"tenants": [{"id": "acme", "currency": "EUR", "timezone": "Europe/Berlin"}, {"id": "globex"}]}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants, err := LoadTenants(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	Tenants = tenants
+	defer func() { Tenants = nil }()
+
+	if tenant, _ := ResolveTenant("globex"); tenant.Currency != DefaultCurrency || tenant.Timezone != DefaultTimezone {
+		t.Fatalf("Expected default currency and timezone, got %+v", tenant)
+	}
+	if _, err := ResolveTenant("initech"); !errors.Is(err, ErrTenantNotFound) {
+		t.Fatalf("Expected unknown tenant to be rejected, got %v", err)
+	}
+	if _, err := ResolveTenant("Not A Tenant"); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected malformed tenant ID to be rejected, got %v", err)
+	}
+	if TenantLocation("acme").String() != "Europe/Berlin" {
+		t.Fatalf("Expected acme timezone, got %s", TenantLocation("acme"))
+	}
+
+	cart := models.Cart{TenantID: "acme", Items: []models.CartItem{{ProductID: "A123", Quantity: 1, Price: 10.0}}}
+	validated, _, err := ValidateCart(cart, false)
+	if err != nil || validated.Currency != "EUR" {
+		t.Fatalf("Expected cart to default to EUR, got %q, %v", validated.Currency, err)
+	}
+	cart.Currency = "usd"
+	if _, _, err := ValidateCart(cart, false); err == nil || err.(*Error).Code != "currency_mismatch" {
+		t.Fatalf("Expected currency mismatch, got %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"tenants": [{"id": "acme"}, {"id": "acme"}]}`,
+		`{"tenants": [{"id": "acme", "currency": "euro"}]}`,
+		`{"tenants": [{"id": "acme", "timezone": "Mars/Olympus"}]}`,
+	} {
+		if err := os.WriteFile(path, []byte(invalid), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTenants(path); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"coupon/models"
+	"fmt"
+	"strings"
+)
+
+// Violation is a single problem found while validating a request.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type violations []Violation
+
+func (v *violations) add(field, code, message string) {
+	*v = append(*v, Violation{Field: field, Code: code, Message: message})
+}
+
+// err folds the collected violations into one error. A single violation keeps its own
+// code and message; several are reported together under "validation_failed".
+func (v violations) err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	if len(v) == 1 {
+		return invalidField(v[0].Code, v[0].Field, v[0].Message).withDetails(map[string]interface{}{
+			"violations": []Violation(v),
+		})
+	}
+
+	messages := make([]string, 0, len(v))
+	for _, violation := range v {
+		messages = append(messages, violation.Message)
+	}
+	return &Error{
+		Kind:    ErrInvalid,
+		Code:    "validation_failed",
+		Message: strings.Join(messages, "; "),
+		Details: map[string]interface{}{"violations": []Violation(v)},
+	}
+}
+
+// validateCoupon checks a complete coupon definition, including the fields its type
+// requires, and reports every violation at once.
+func validateCoupon(coupon models.Coupon) error {
+	var found violations
+
+	if strings.TrimSpace(coupon.ID) == "" {
+		found.add("id", "id_required", "coupon ID is required")
+	} else if hasControlCharacters(coupon.ID) {
+		found.add("id", "invalid_id", "coupon ID cannot contain control characters")
+	}
+	for _, code := range append([]string{coupon.Code}, coupon.Aliases...) {
+		if hasControlCharacters(code) {
+			found.add("code", "invalid_code", "coupon codes cannot contain control characters")
+			break
+		}
+	}
+
+	details := coupon.Details
+	checkCouponDetails(details, &found)
+
+	switch coupon.Type {
+	case "cart-wise":
+		if details.Threshold <= 0 {
+			found.add("details.threshold", "threshold_required", "threshold is required for cart-wise coupons")
+		}
+		if details.Discount <= 0 {
+			found.add("details.discount", "discount_required", "discount is required for cart-wise coupons")
+		}
+	case "product-wise":
+		if details.ProductID == "" {
+			found.add("details.product_id", "product_id_required", "product ID is required for product-wise coupons")
+		}
+		if details.Discount <= 0 {
+			found.add("details.discount", "discount_required", "discount is required for product-wise coupons")
+		}
+	case "bxgy":
+		if len(details.BuyProducts) == 0 {
+			found.add("details.buy_products", "buy_products_required", "buy products are required for BxGy coupons")
+		}
+		for i, product := range details.BuyProducts {
+			checkProductQuantity(fmt.Sprintf("details.buy_products[%d]", i), product.ProductID, product.Quantity, &found)
+		}
+		if len(details.GetProducts) == 0 {
+			found.add("details.get_products", "get_products_required", "get products are required for BxGy coupons")
+		}
+		for i, product := range details.GetProducts {
+			checkProductQuantity(fmt.Sprintf("details.get_products[%d]", i), product.ProductID, product.Quantity, &found)
+		}
+		if details.RepetitionLimit <= 0 {
+			found.add("details.repetition_limit", "invalid_repetition_limit", "invalid repetition limit for BxGy coupon")
+		}
+	case "":
+		found.add("type", "type_required", "coupon type is required")
+	default:
+		found.add("type", "invalid_coupon_type", fmt.Sprintf("unsupported coupon type: %s", coupon.Type))
+	}
+
+	return found.err()
+}
+
+func checkCouponDetails(details models.CouponDetails, found *violations) {
+	if details.Threshold < 0 {
+		found.add("details.threshold", "invalid_threshold", "invalid threshold: cannot be negative")
+	}
+	if details.Discount < 0 || details.Discount > 100 {
+		found.add("details.discount", "invalid_discount", "invalid discount: must be between 0 and 100")
+	}
+	if details.MinCartValue < 0 {
+		found.add("details.min_cart_value", "invalid_min_cart_value", "invalid min cart value: cannot be negative")
+	}
+	if details.MaxUses < 0 {
+		found.add("details.max_uses", "invalid_max_uses", "invalid max uses: cannot be negative")
+	}
+	if details.MaxUsesPerCustomer < 0 {
+		found.add("details.max_uses_per_customer", "invalid_max_uses_per_customer", "invalid max uses per customer: must be positive")
+	}
+	if details.MaxAccountAgeDays < 0 {
+		found.add("details.max_account_age_days", "invalid_max_account_age_days", "invalid max account age: must be positive")
+	}
+	if details.MinDaysSinceLastOrder < 0 {
+		found.add("details.min_days_since_last_order", "invalid_min_days_since_last_order", "invalid min days since last order: must be positive")
+	}
+	if details.StartDate != nil && details.ExpiryDate != nil && !details.StartDate.Before(*details.ExpiryDate) {
+		found.add("details.start_date", "invalid_start_date", "start date must be before the expiry date")
+	}
+	if details.Uses < 0 {
+		found.add("details.uses", "invalid_uses", "invalid uses: cannot be negative")
+	}
+	if details.MaxUses > 0 && details.Uses > details.MaxUses {
+		found.add("details.uses", "uses_exceed_max_uses", "uses cannot exceed max uses")
+	}
+}
+
+func checkProductQuantity(field, productID string, quantity int, found *violations) {
+	if productID == "" {
+		found.add(field+".product_id", "product_id_required", "product ID is required")
+	}
+	if quantity <= 0 {
+		found.add(field+".quantity", "invalid_quantity", "quantity must be positive")
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"coupon/models"
+	"errors"
+	"testing"
+)
+
+func TestCreateCoupon_Validation(t *testing.T) {
+	Coupons = make(map[string]models.Coupon)
+	CouponCodes = make(map[string]string)
+
+	coupon := models.Coupon{
+		Type: "bxgy",
+		Details: models.CouponDetails{
+			BuyProducts: []models.BuyProduct{{ProductID: "A123", Quantity: 0}},
+			Discount:    150.0,
+		},
+	}
+
+	err := CreateCoupon(coupon)
+	var serviceErr *Error
+	if !errors.As(err, &serviceErr) || !errors.Is(err, ErrInvalid) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+	if serviceErr.Code != "validation_failed" {
+		t.Fatalf("Expected code validation_failed, got %s", serviceErr.Code)
+	}
+
+	expected := map[string]string{
+		"id":                               "id_required",
+		"details.discount":                 "invalid_discount",
+		"details.buy_products[0].quantity": "invalid_quantity",
+		"details.get_products":             "get_products_required",
+		"details.repetition_limit":         "invalid_repetition_limit",
+	}
+	found := serviceErr.Details["violations"].([]Violation)
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d violations, got %+v", len(expected), found)
+	}
+	for _, violation := range found {
+		if expected[violation.Field] != violation.Code {
+			t.Fatalf("Unexpected violation %+v", violation)
+		}
+	}
+
+	err = CreateCoupon(models.Coupon{ID: "1", Type: "product-wise", Details: models.CouponDetails{Discount: 10.0}})
+	if err == nil || err.Error() != "product ID is required for product-wise coupons" {
+		t.Fatalf("Expected 'product ID is required for product-wise coupons', got %v", err)
+	}
+
+	err = CreateCoupon(models.Coupon{ID: "1", Type: "percent-off"})
+	if err == nil || err.Error() != "unsupported coupon type: percent-off" {
+		t.Fatalf("Expected 'unsupported coupon type: percent-off', got %v", err)
+	}
+}